@@ -7,7 +7,9 @@ toolchain go1.22.3
 require (
 	github.com/fatih/color v1.16.0
 	github.com/hiddify/hiddify-core v1.9.1-0.20240929205909-e8e7efc513bb
+	github.com/sagernet/sing-box v1.8.9
 	golang.org/x/crypto v0.26.0
+	nhooyr.io/websocket v1.8.6
 )
 
 require (
@@ -85,7 +87,6 @@ require (
 	github.com/sagernet/quic-go v0.47.0-beta.2 // indirect
 	github.com/sagernet/reality v0.0.0-20230406110435-ee17307e7691 // indirect
 	github.com/sagernet/sing v0.4.3 // indirect
-	github.com/sagernet/sing-box v1.8.9 // indirect
 	github.com/sagernet/sing-dns v0.2.3 // indirect
 	github.com/sagernet/sing-mux v0.2.0 // indirect
 	github.com/sagernet/sing-quic v0.2.2 // indirect
@@ -126,7 +127,6 @@ require (
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	lukechampine.com/blake3 v1.3.0 // indirect
-	nhooyr.io/websocket v1.8.6 // indirect
 )
 
 replace github.com/sagernet/sing-box => github.com/hiddify/hiddify-sing-box v1.8.9-0.20240928213625-7b79bf0c814d
@@ -0,0 +1,77 @@
+package hiddify_extension
+
+import (
+	"fmt"
+
+	"github.com/hiddify/hiddify-core/extension/ui"
+)
+
+// Rarely changed settings, hidden until the advanced settings are shown. Hidden fields are not
+// submitted, so they keep their values.
+var advancedFieldKeys = map[string]bool{
+	MaxKeysKey:              true,
+	LatencySamplesKey:       true,
+	SpeedTestMBKey:          true,
+	CiphersKey:              true,
+	KeyExchangesKey:         true,
+	MACsKey:                 true,
+	HostKeyAlgorithmsKey:    true,
+	RekeyThresholdKey:       true,
+	KnownHostsMatchKey:      true,
+	FingerprintFormatKey:    true,
+	LocalDNSKey:             true,
+	PinResolvedIPKey:        true,
+	ReverseDNSKey:           true,
+	PortCheckKey:            true,
+	DSCPKey:                 true,
+	UseSystemProxyKey:       true,
+	JumpShareAuthKey:        true,
+	UpstreamOutboundKey:     true,
+	GreetingKey:             true,
+	ConsoleWidthKey:         true,
+	ConsoleWrapKey:          true,
+	ServerAliveIntervalKey:  true,
+	ServerAliveCountMaxKey:  true,
+	ConnectAttemptsKey:      true,
+	ConnectRateKey:          true,
+	ConnectTimeoutKey:       true,
+	ConnectTimeoutMaxKey:    true,
+	HandshakeTimeoutKey:     true,
+	RetryAuthErrorsKey:      true,
+	WaitForConnectKey:       true,
+	HealthPortKey:           true,
+	GlobalRequestKey:        true,
+	GlobalRequestPayloadKey: true,
+	MTUProbeKey:             true,
+	MTUProbeTargetKey:       true,
+	MTUProbeMinKey:          true,
+	MTUProbeMaxKey:          true,
+	LogMaxSizeKBKey:         true,
+	LogMaxFilesKey:          true,
+	HostLogKey:              true,
+	TraceFilePathKey:        true,
+	TraceMaxSizeKBKey:       true,
+	TranscriptMaxKBKey:      true,
+}
+
+// visibleFields drops the advanced fields unless they are shown
+func (e *HiddifyExtensionSimpleSsh) visibleFields(fields []ui.FormField) []ui.FormField {
+	if e.showAdvanced.Load() {
+		return fields
+	}
+	visible := fields[:0]
+	for _, field := range fields {
+		if !advancedFieldKeys[field.Key] {
+			visible = append(visible, field)
+		}
+	}
+	return visible
+}
+
+// advancedLabel names the action toggling the advanced settings
+func (e *HiddifyExtensionSimpleSsh) advancedLabel() string {
+	if e.showAdvanced.Load() {
+		return "Hide advanced settings"
+	}
+	return fmt.Sprintf("Show advanced settings (%d hidden)", len(advancedFieldKeys))
+}
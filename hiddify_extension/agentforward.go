@@ -0,0 +1,39 @@
+package hiddify_extension
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Returned when agent forwarding is enabled without the SSH agent
+var errForwardAgentNeedsAgent = errors.New("agent forwarding needs \"Use SSH Agent\" to be enabled")
+
+// forwardAgent serves the local SSH agent to the server and asks for it on the session.
+// The returned cleanup function closes the agent connection once the session is over.
+func (e *HiddifyExtensionSimpleSsh) forwardAgent(client *ssh.Client, session *ssh.Session) (func(), error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, errors.New("SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH agent: %w", err)
+	}
+	if err := agent.ForwardToAgent(client, agent.NewClient(conn)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := agent.RequestAgentForwarding(session); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Anyone with access to the remote socket can sign with the agent keys
+	e.addAndUpdateConsole(yellow.Sprint("Agent forwarding: "), "the server can use your agent keys while this session is open, only forward to hosts you trust")
+	return func() { conn.Close() }, nil
+}
@@ -0,0 +1,142 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Host key algorithms supported by the SSH client
+var supportedHostKeyAlgorithms = []string{
+	ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSASHA512v01,
+	ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.CertAlgoECDSA256v01,
+	ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoED25519v01,
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512,
+	ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+	ssh.KeyAlgoED25519,
+}
+
+// Ciphers, key exchanges and MACs supported by the SSH client
+var (
+	supportedCiphers = []string{
+		"chacha20-poly1305@openssh.com", "aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-cbc", "3des-cbc", "arcfour256", "arcfour128", "arcfour",
+	}
+	supportedKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512", "diffie-hellman-group-exchange-sha256",
+		"diffie-hellman-group14-sha1", "diffie-hellman-group-exchange-sha1", "diffie-hellman-group1-sha1",
+	}
+	supportedMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512", "hmac-sha1", "hmac-sha1-96",
+	}
+)
+
+// Algorithm presets
+const (
+	PresetDefault = "default" // The SSH library's defaults
+	PresetModern  = "modern"  // AEAD ciphers and curve25519 only
+	PresetFIPS    = "fips"    // FIPS 140 approved algorithms only
+	PresetLegacy  = "legacy"  // Adds older algorithms for outdated servers
+)
+
+// algorithmSet holds the algorithms offered during the handshake; empty lists keep the defaults
+type algorithmSet struct {
+	ciphers      []string
+	keyExchanges []string
+	macs         []string
+	hostKeys     []string
+}
+
+// Algorithms offered by each preset
+var algorithmPresets = map[string]algorithmSet{
+	PresetDefault: {},
+	PresetModern: {
+		ciphers:      []string{"chacha20-poly1305@openssh.com", "aes256-gcm@openssh.com", "aes128-gcm@openssh.com"},
+		keyExchanges: []string{"curve25519-sha256", "curve25519-sha256@libssh.org"},
+		macs:         []string{"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com"},
+		hostKeys: []string{
+			ssh.KeyAlgoED25519, ssh.CertAlgoED25519v01,
+			ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01,
+		},
+	},
+	PresetFIPS: {
+		ciphers:      []string{"aes256-gcm@openssh.com", "aes128-gcm@openssh.com", "aes256-ctr", "aes192-ctr", "aes128-ctr"},
+		keyExchanges: []string{"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521", "diffie-hellman-group16-sha512", "diffie-hellman-group14-sha256"},
+		macs:         []string{"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com", "hmac-sha2-256", "hmac-sha2-512"},
+		hostKeys: []string{
+			ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+			ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01,
+		},
+	},
+	PresetLegacy: {
+		ciphers:      supportedCiphers,
+		keyExchanges: supportedKeyExchanges,
+		macs:         supportedMACs,
+		hostKeys:     supportedHostKeyAlgorithms,
+	},
+}
+
+// resolveAlgorithms expands the preset and applies the explicit lists, which take precedence
+func resolveAlgorithms(data HiddifyExtensionSimpleSshData) (algorithmSet, error) {
+	set, ok := algorithmPresets[data.AlgorithmPreset]
+	if !ok {
+		return algorithmSet{}, fmt.Errorf("unknown algorithm preset %q", data.AlgorithmPreset)
+	}
+	for _, list := range []struct {
+		value     string
+		supported []string
+		what      string
+		target    *[]string
+	}{
+		{data.Ciphers, supportedCiphers, "cipher", &set.ciphers},
+		{data.KeyExchanges, supportedKeyExchanges, "key exchange", &set.keyExchanges},
+		{data.MACs, supportedMACs, "MAC", &set.macs},
+		{data.HostKeyAlgorithms, supportedHostKeyAlgorithms, "host key", &set.hostKeys},
+	} {
+		algorithms, err := parseAlgorithmList(list.value, list.supported, list.what)
+		if err != nil {
+			return algorithmSet{}, err
+		}
+		if len(algorithms) > 0 {
+			*list.target = algorithms
+		}
+	}
+	return set, nil
+}
+
+// describe lists the algorithms for the console, naming the defaults that are kept
+func (set algorithmSet) describe() string {
+	list := func(algorithms []string) string {
+		if len(algorithms) == 0 {
+			return "default"
+		}
+		return strings.Join(algorithms, ",")
+	}
+	return fmt.Sprintf("ciphers %s; kex %s; macs %s; host keys %s", list(set.ciphers), list(set.keyExchanges), list(set.macs), list(set.hostKeys))
+}
+
+// Smallest accepted rekey threshold; lower values would rekey constantly
+const minRekeyThreshold = 1 << 20
+
+// parseAlgorithmList splits a comma-separated algorithm list and rejects unknown names
+func parseAlgorithmList(value string, supported []string, what string) ([]string, error) {
+	var algorithms []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(supported, name) {
+			return nil, fmt.Errorf("unknown %s algorithm %q", what, name)
+		}
+		algorithms = append(algorithms, name)
+	}
+	return algorithms, nil
+}
@@ -0,0 +1,69 @@
+package hiddify_extension
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolveAlgorithms(t *testing.T) {
+	modern := algorithmPresets[PresetModern]
+	tests := []struct {
+		name    string
+		change  func(d *HiddifyExtensionSimpleSshData)
+		want    algorithmSet
+		wantErr string
+	}{
+		{"default", func(d *HiddifyExtensionSimpleSshData) {}, algorithmSet{}, ""},
+		{"modern", func(d *HiddifyExtensionSimpleSshData) { d.AlgorithmPreset = PresetModern }, modern, ""},
+		{"fips", func(d *HiddifyExtensionSimpleSshData) { d.AlgorithmPreset = PresetFIPS }, algorithmPresets[PresetFIPS], ""},
+		{"legacy", func(d *HiddifyExtensionSimpleSshData) { d.AlgorithmPreset = PresetLegacy }, algorithmSet{supportedCiphers, supportedKeyExchanges, supportedMACs, supportedHostKeyAlgorithms}, ""},
+		{"explicit list over preset", func(d *HiddifyExtensionSimpleSshData) {
+			d.AlgorithmPreset, d.Ciphers = PresetModern, " aes128-ctr, aes256-ctr "
+		}, algorithmSet{[]string{"aes128-ctr", "aes256-ctr"}, modern.keyExchanges, modern.macs, modern.hostKeys}, ""},
+		{"explicit list over default", func(d *HiddifyExtensionSimpleSshData) { d.MACs = "hmac-sha2-256" }, algorithmSet{macs: []string{"hmac-sha2-256"}}, ""},
+		{"unknown preset", func(d *HiddifyExtensionSimpleSshData) { d.AlgorithmPreset = "fastest" }, algorithmSet{}, `unknown algorithm preset "fastest"`},
+		{"unknown cipher", func(d *HiddifyExtensionSimpleSshData) { d.Ciphers = "aes128-ctr,rot13" }, algorithmSet{}, `unknown cipher algorithm "rot13"`},
+		{"unknown host key", func(d *HiddifyExtensionSimpleSshData) { d.HostKeyAlgorithms = "ssh-dss2" }, algorithmSet{}, `unknown host key algorithm "ssh-dss2"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh).Base.Data
+			tt.change(&data)
+			got, err := resolveAlgorithms(data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveAlgorithms() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveAlgorithms() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveAlgorithms() = %s, want %s", got.describe(), tt.want.describe())
+			}
+		})
+	}
+}
+
+func TestAlgorithmPresetsSupported(t *testing.T) {
+	for name, set := range algorithmPresets {
+		for _, list := range []struct {
+			algorithms []string
+			supported  []string
+		}{
+			{set.ciphers, supportedCiphers},
+			{set.keyExchanges, supportedKeyExchanges},
+			{set.macs, supportedMACs},
+			{set.hostKeys, supportedHostKeyAlgorithms},
+		} {
+			for _, algorithm := range list.algorithms {
+				if !slices.Contains(list.supported, algorithm) {
+					t.Errorf("preset %s offers unsupported algorithm %q", name, algorithm)
+				}
+			}
+		}
+	}
+}
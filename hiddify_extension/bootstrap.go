@@ -0,0 +1,121 @@
+package hiddify_extension
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Environment variables used to provision the initial settings of headless deployments
+const (
+	configEnv      = "SIMPLE_SSH_CONFIG"       // Settings as JSON
+	configFileEnv  = "SIMPLE_SSH_CONFIG_FILE"  // Path of a JSON settings file
+	configForceEnv = "SIMPLE_SSH_CONFIG_FORCE" // Set to true to override saved settings as well
+)
+
+// loadBootstrapConfig applies the settings provided through the environment on top of base.
+// The source is empty when no settings are provided.
+func loadBootstrapConfig(base HiddifyExtensionSimpleSshData) (data HiddifyExtensionSimpleSshData, source string, err error) {
+	var content []byte
+	switch {
+	case os.Getenv(configEnv) != "":
+		source, content = "$"+configEnv, []byte(os.Getenv(configEnv))
+	case os.Getenv(configFileEnv) != "":
+		source = os.Getenv(configFileEnv)
+		if content, err = os.ReadFile(source); err != nil {
+			return base, source, err
+		}
+	default:
+		return base, "", nil
+	}
+
+	// Reject unknown keys and wrong types so typos do not go unnoticed
+	type plain HiddifyExtensionSimpleSshData // Skips the lenient UnmarshalJSON
+	data = base
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode((*plain)(&data)); err != nil {
+		return base, source, err
+	}
+	if err := validateData(data, base); err != nil {
+		return base, source, err
+	}
+	return data, source, nil
+}
+
+// forceBootstrapConfig reports whether the provided settings override saved ones
+func forceBootstrapConfig() bool {
+	force, _ := strconv.ParseBool(os.Getenv(configForceEnv))
+	return force
+}
+
+// validateData applies the form's checks to settings that did not come through the form
+func validateData(data HiddifyExtensionSimpleSshData, defaults HiddifyExtensionSimpleSshData) error {
+	if _, err := resolveAlgorithms(data); err != nil {
+		return err
+	}
+	if _, err := parsePinnedHostKeys(data.HostKeys); err != nil {
+		return err
+	}
+	if _, err := parseDNSServers(data.LocalDNS); err != nil {
+		return err
+	}
+	if _, err := parsePort(data.Port); err != nil {
+		return err
+	}
+	if _, err := parseFallbackPorts(data.FallbackPorts); err != nil {
+		return err
+	}
+	if _, err := parseSplitTunnelRules(data.SplitTunnelRules); err != nil {
+		return err
+	}
+	if _, err := parseJumpHosts(data.JumpHosts); err != nil {
+		return err
+	}
+	if err := validateTokens(data.Command); err != nil {
+		return err
+	}
+	if err := validateTokens(data.DiagnosticCommands); err != nil {
+		return err
+	}
+	if err := validateTokens(data.PostConnectSteps); err != nil {
+		return err
+	}
+	if err := validateRequestName(data.GlobalRequest); err != nil {
+		return err
+	}
+	if err := validateTransport(data); err != nil {
+		return err
+	}
+	if err := validateMTUProbe(data); err != nil {
+		return err
+	}
+	if err := validateUpstream(data); err != nil {
+		return err
+	}
+
+	// Any value the loader would reset is out of range
+	restored := data
+	restored.restoreInvalidDefaults(defaults)
+	if restored != data {
+		return errors.New("settings contain out of range values")
+	}
+	return nil
+}
+
+// applyBootstrapConfig loads the settings provided through the environment, if any.
+// It runs before the UI is attached, so the outcome is only recorded in the console.
+func (e *HiddifyExtensionSimpleSsh) applyBootstrapConfig() {
+	data, source, err := loadBootstrapConfig(e.Base.Data)
+	switch {
+	case source == "":
+	case err != nil:
+		e.console = red.Sprint("Ignoring settings from ", source, ": ") + err.Error() + "\n" + e.console
+	default:
+		e.Base.Data = data
+		e.console = yellow.Sprint("Loaded settings from: ") + fmt.Sprintf("%s (saved settings take precedence: %t)", source, !forceBootstrapConfig()) + "\n" + e.console
+	}
+}
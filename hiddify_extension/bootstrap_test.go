@@ -0,0 +1,74 @@
+package hiddify_extension
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadBootstrapConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(file, []byte(`{"ip": "file.test", "port": "2222"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		config     string // SIMPLE_SSH_CONFIG
+		configFile string // SIMPLE_SSH_CONFIG_FILE
+		wantSource string
+		wantIP     string
+		wantErr    string
+	}{
+		{"none", "", "", "", "saved.test", ""},
+		{"environment", `{"ip": "env.test", "mode": "shell"}`, "", "$" + configEnv, "env.test", ""},
+		{"file", "", file, file, "file.test", ""},
+		{"environment before file", `{"ip": "env.test"}`, file, "$" + configEnv, "env.test", ""},
+		{"missing file", "", filepath.Join(t.TempDir(), "missing.json"), "", "saved.test", "no such file"},
+		{"unknown key", `{"ip": "env.test", "hostname": "typo.test"}`, "", "$" + configEnv, "saved.test", "unknown field"},
+		{"wrong type", `{"port": 22}`, "", "$" + configEnv, "saved.test", "cannot unmarshal"},
+		{"invalid value", `{"port": "99999"}`, "", "$" + configEnv, "saved.test", "port"},
+		{"out of range", `{"mode": "bogus"}`, "", "$" + configEnv, "saved.test", "out of range"},
+		{"old template schema", `{"count": 3}`, "", "$" + configEnv, "saved.test", "unknown field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(configEnv, tt.config)
+			t.Setenv(configFileEnv, tt.configFile)
+			base := NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh).Base.Data
+			base.IP = "saved.test"
+
+			data, source, err := loadBootstrapConfig(base)
+			if tt.wantSource != "" && source != tt.wantSource {
+				t.Errorf("source = %q, want %q", source, tt.wantSource)
+			}
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("loadBootstrapConfig() error = %v, want %q", err, tt.wantErr)
+			}
+			if data.IP != tt.wantIP {
+				t.Errorf("IP = %q, want %q", data.IP, tt.wantIP)
+			}
+			if err != nil && data != base {
+				t.Error("rejected settings were partly applied")
+			}
+		})
+	}
+}
+
+func TestApplyBootstrapConfig(t *testing.T) {
+	t.Setenv(configEnv, `{"ip": "env.test", "username": "deploy"}`)
+	e := NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh)
+	if e.Base.Data.IP != "env.test" || e.Base.Data.Username != "deploy" {
+		t.Errorf("IP, Username = %q, %q, want the provisioned settings", e.Base.Data.IP, e.Base.Data.Username)
+	}
+	if !strings.Contains(e.consoleText(), "Loaded settings from") {
+		t.Errorf("console does not report the provisioned settings:\n%s", e.consoleText())
+	}
+
+	t.Setenv(configEnv, `{"ip": 1}`)
+	e = NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh)
+	if e.Base.Data.IP == "1" || !strings.Contains(e.consoleText(), "Ignoring settings from") {
+		t.Errorf("invalid provisioned settings were not ignored, console:\n%s", e.consoleText())
+	}
+}
@@ -0,0 +1,76 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"strings"
+)
+
+// equivalentCommand describes the current settings as an OpenSSH command line, without secrets
+func (e *HiddifyExtensionSimpleSsh) equivalentCommand() string {
+	data := e.data()
+	args := []string{"ssh", "-p", data.Port}
+
+	if strings.TrimSpace(data.PrivateKey) != "" {
+		args = append(args, "-i", "<private-key-file>") // Never reveal key material
+	}
+	if algorithms, err := resolveAlgorithms(data); err == nil {
+		for _, option := range []struct {
+			name       string
+			algorithms []string
+		}{
+			{"Ciphers", algorithms.ciphers},
+			{"KexAlgorithms", algorithms.keyExchanges},
+			{"MACs", algorithms.macs},
+			{"HostKeyAlgorithms", algorithms.hostKeys},
+		} {
+			if len(option.algorithms) > 0 {
+				args = append(args, "-o", shellQuote(option.name+"="+strings.Join(option.algorithms, ",")))
+			}
+		}
+	}
+
+	if data.ForwardAgent {
+		args = append(args, "-A")
+	}
+
+	if hops, err := parseJumpHosts(data.JumpHosts); err == nil && len(hops) > 0 {
+		chain := make([]string, 0, len(hops))
+		for _, hop := range hops {
+			chain = append(chain, hop.String()) // Passwords are left out
+		}
+		args = append(args, "-J", shellQuote(strings.Join(chain, ",")))
+	}
+
+	switch data.Transport {
+	case TransportTLS:
+		serverName := data.TLSServerName
+		if serverName == "" {
+			serverName = data.IP
+		}
+		proxy := fmt.Sprintf("ProxyCommand=openssl s_client -quiet -connect %s:%s -servername %s", data.IP, data.Port, serverName)
+		args = append(args, "-o", shellQuote(proxy))
+	case TransportWebSocket:
+		args = append(args, "-o", shellQuote("ProxyCommand=websocat --binary "+redactURL(data.WebSocketURL)))
+	}
+
+	if data.Mode == ModeSubsystem {
+		args = append(args, "-s", fmt.Sprintf("%s@%s", data.Username, data.IP), shellQuote(data.Subsystem))
+	} else {
+		command, err := expandTokens(data.Command, e.commandTokens()) // ssh does not expand tokens in the command line
+		if err != nil {
+			command = data.Command
+		}
+		args = append(args, fmt.Sprintf("%s@%s", data.Username, data.IP), shellQuote(command))
+	}
+	return strings.Join(args, " ")
+}
+
+// shellQuote quotes a value for a POSIX shell when needed
+func shellQuote(value string) string {
+	if value != "" && strings.IndexFunc(value, func(r rune) bool {
+		return !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.,/:=@%+", r)
+	}) < 0 {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
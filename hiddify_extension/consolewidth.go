@@ -0,0 +1,85 @@
+package hiddify_extension
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Narrowest console width accepted, leaving room for a label and some text
+const minConsoleWidth = 10
+
+// fitConsole wraps or truncates each line of text to width visible characters; 0 leaves the text
+// unchanged. Color escape sequences take no room and are kept, so colors still end where they should.
+func fitConsole(text string, width int, wrap bool) string {
+	if width <= 0 {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = fitLine(line, width, wrap)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fitLine wraps or truncates a single line, ending a truncated line with an ellipsis
+func fitLine(line string, width int, wrap bool) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line // Escape sequences only make the count larger
+	}
+
+	var sb strings.Builder
+	visible := 0
+	for len(line) > 0 {
+		if n := escapeLength(line); n > 0 {
+			sb.WriteString(line[:n])
+			line = line[n:]
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line)
+		line = line[size:]
+		switch {
+		case visible < width:
+		case wrap:
+			sb.WriteByte('\n')
+			visible = 0
+		default:
+			continue // Past the ellipsis, only escape sequences are kept
+		}
+		if !wrap && visible == width-1 && visibleRunes(line) > 0 {
+			sb.WriteRune('…')
+			visible = width
+			continue
+		}
+		sb.WriteRune(r)
+		visible++
+	}
+	return sb.String()
+}
+
+// escapeLength returns the length of the CSI escape sequence text starts with, or 0
+func escapeLength(text string) int {
+	if !strings.HasPrefix(text, "\x1b[") {
+		return 0
+	}
+	for i := 2; i < len(text); i++ {
+		if text[i] >= 0x40 && text[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// visibleRunes counts the characters of text outside escape sequences
+func visibleRunes(text string) int {
+	count := 0
+	for len(text) > 0 {
+		if n := escapeLength(text); n > 0 {
+			text = text[n:]
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text)
+		text = text[size:]
+		count++
+	}
+	return count
+}
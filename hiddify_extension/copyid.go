@@ -0,0 +1,134 @@
+package hiddify_extension
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Remote commands preparing ~/.ssh with the permissions sshd requires and ending the file with a newline
+const authorizedKeysSetup = `umask 077 && mkdir -p ~/.ssh && chmod 700 ~/.ssh && touch ~/.ssh/authorized_keys && chmod 600 ~/.ssh/authorized_keys && ` +
+	`if [ -s ~/.ssh/authorized_keys ] && [ -n "$(tail -c 1 ~/.ssh/authorized_keys)" ]; then echo >> ~/.ssh/authorized_keys; fi`
+
+// installKeyScript returns the remote command appending each key to authorized_keys unless already
+// present, printing "added" or "present" for each key in order
+func installKeyScript(keys []ssh.PublicKey) string {
+	var sb strings.Builder
+	sb.WriteString(authorizedKeysSetup)
+	for _, key := range keys {
+		// Match on the key itself so an existing entry with another comment or options counts
+		blob := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+		line := blob + " " + generatedKeyComment
+		fmt.Fprintf(&sb, " && if grep -qF %s ~/.ssh/authorized_keys; then echo present; else echo %s >> ~/.ssh/authorized_keys && echo added; fi",
+			shellQuote(blob), shellQuote(line))
+	}
+	return sb.String()
+}
+
+// installedKeySigners loads the private keys whose public keys are installed
+func (e *HiddifyExtensionSimpleSsh) installedKeySigners() ([]ssh.Signer, error) {
+	data := e.data()
+	if strings.TrimSpace(data.PrivateKey) == "" {
+		return nil, errors.New("no private key is set, paste one or generate a key pair first")
+	}
+	var signers []ssh.Signer
+	for i, block := range splitPrivateKeys(data.PrivateKey) {
+		signer, err := parsePrivateKey(block, data.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("private key %d: %w", i+1, err)
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+// installKeyTask logs in with the password, adds the public keys to the server's authorized_keys
+// and checks that the keys log in on their own
+func (e *HiddifyExtensionSimpleSsh) installKeyTask(ctx context.Context, task uint64) {
+	data := e.data()
+	defer func() {
+		e.lifecycle.finished(task)
+		e.UpdateUI(e.form()) // Show the final state
+	}()
+
+	signers, err := e.installedKeySigners()
+	if err != nil {
+		e.addAndUpdateConsole(red.Sprint("Cannot install key: "), err.Error())
+		return
+	}
+	if data.Password == "" {
+		e.addAndUpdateConsole(red.Sprint("Cannot install key: "), "a password is needed to log in before the key is installed")
+		return
+	}
+	var keys []ssh.PublicKey
+	for _, signer := range signers {
+		keys = append(keys, signer.PublicKey())
+	}
+
+	// Log in with the password only, the key is not accepted yet
+	e.addAndUpdateConsole(yellow.Sprint("Installing public keys: "), fmt.Sprintf("logging in with the password to add %d keys", len(keys)))
+	client, err := e.connectWith(ctx, func() ([]ssh.AuthMethod, func(), error) {
+		e.addAndUpdateConsole(yellow.Sprint("Authentication methods (1): "), "password")
+		return []ssh.AuthMethod{passwordAuth{ssh.Password(data.Password)}}, func() {}, nil
+	})
+	if err != nil {
+		return
+	}
+	e.lifecycle.connected(task)
+	output, err := e.runInstallScript(ctx, client, keys)
+	client.Close()
+	if err != nil {
+		e.addAndUpdateConsole(red.Sprint("Failed to update authorized_keys: "), err.Error()+" (the server needs a POSIX shell)")
+		return
+	}
+	results := strings.Fields(output)
+	for i, key := range keys {
+		result := "unknown"
+		if i < len(results) {
+			result = results[i]
+		}
+		switch result {
+		case "added":
+			e.addAndUpdateConsole(green.Sprint("Key installed: "), key.Type()+" "+ssh.FingerprintSHA256(key))
+		case "present":
+			e.addAndUpdateConsole(yellow.Sprint("Key already installed: "), key.Type()+" "+ssh.FingerprintSHA256(key))
+		default:
+			e.addAndUpdateConsole(red.Sprint("Unexpected result for key: "), key.Type()+" "+ssh.FingerprintSHA256(key)+": "+sanitizeText(result))
+		}
+	}
+
+	// Log in again with the keys only to prove they work
+	e.addAndUpdateConsole(yellow.Sprint("Verifying key login"))
+	client, err = e.connectWith(ctx, func() ([]ssh.AuthMethod, func(), error) {
+		e.addAndUpdateConsole(yellow.Sprint("Authentication methods (1): "), "publickey")
+		return []ssh.AuthMethod{ssh.PublicKeys(signers...)}, func() {}, nil
+	})
+	if err != nil {
+		e.addAndUpdateConsole(red.Sprint("Key login failed: "), "the server may not allow public key authentication or may check another authorized_keys file")
+		return
+	}
+	client.Close()
+	e.addAndUpdateConsole(green.Sprint("Key login verified: "), "the password can now be cleared")
+}
+
+// runInstallScript runs the authorized_keys update and returns its output
+func (e *HiddifyExtensionSimpleSsh) runInstallScript(ctx context.Context, client *ssh.Client, keys []ssh.PublicKey) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	defer stop()
+
+	var stderr strings.Builder
+	session.Stderr = &stderr
+	output, err := session.Output(installKeyScript(keys))
+	if err != nil && stderr.Len() > 0 {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return string(output), err
+}
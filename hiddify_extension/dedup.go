@@ -0,0 +1,54 @@
+package hiddify_extension
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// Returned by lifecycle.start when the running task already uses the submitted settings
+var errAlreadyRunning = errors.New("a connection with the same settings is already running")
+
+// Reload classes of the extension data fields, set with the reload struct tag
+const (
+	reloadReconnect = "reconnect" // Changing the field rebuilds the running connection
+	reloadLive      = "live"      // The field is read when used, so the running connection picks it up
+)
+
+// connectionSettings holds only the fields that change what a connection does; resubmitting the
+// form with the same values keeps the running connection instead of rebuilding it
+type connectionSettings HiddifyExtensionSimpleSshData
+
+// fieldReload returns the reload class of a data field. Untagged fields are treated as needing
+// a reconnect, so forgetting to classify a new field never leaves a stale connection running.
+func fieldReload(field reflect.StructField) string {
+	if field.Tag.Get("reload") == reloadLive {
+		return reloadLive
+	}
+	return reloadReconnect
+}
+
+// connectionSettingsOf extracts the connection settings from the extension data
+func connectionSettingsOf(data HiddifyExtensionSimpleSshData) connectionSettings {
+	var settings connectionSettings
+	from, to := reflect.ValueOf(data), reflect.ValueOf(&settings).Elem()
+	for i := 0; i < from.NumField(); i++ {
+		if fieldReload(from.Type().Field(i)) == reloadReconnect {
+			to.Field(i).Set(from.Field(i))
+		}
+	}
+	return settings
+}
+
+// changedSettings names the connection settings that differ, by their saved key
+func changedSettings(old connectionSettings, new connectionSettings) []string {
+	var names []string
+	a, b := reflect.ValueOf(old), reflect.ValueOf(new)
+	for i := 0; i < a.NumField(); i++ {
+		if !a.Field(i).Equal(b.Field(i)) {
+			name, _, _ := strings.Cut(a.Type().Field(i).Tag.Get("json"), ",")
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,60 @@
+package hiddify_extension
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestReloadTags(t *testing.T) {
+	fields := reflect.TypeOf(HiddifyExtensionSimpleSshData{})
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		if reload := field.Tag.Get("reload"); reload != reloadReconnect && reload != reloadLive {
+			t.Errorf("field %s has reload tag %q, want %q or %q", field.Name, reload, reloadReconnect, reloadLive)
+		}
+	}
+}
+
+func TestSettingsChange(t *testing.T) {
+	tests := []struct {
+		name          string
+		change        func(d *HiddifyExtensionSimpleSshData)
+		wantReconnect string // Saved key of the changed setting, empty if the connection is kept
+	}{
+		{"unchanged", func(d *HiddifyExtensionSimpleSshData) {}, ""},
+		{"live field", func(d *HiddifyExtensionSimpleSshData) { d.ConnectAttempts++ }, ""},
+		{"reconnect field", func(d *HiddifyExtensionSimpleSshData) { d.Port = "2222" }, "port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh).Base.Data
+			running := connectionSettingsOf(data)
+			var l lifecycle
+			if _, _, err := l.start(&running); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.change(&data)
+			submitted := connectionSettingsOf(data)
+			changed := changedSettings(running, submitted)
+			_, _, err := l.start(&submitted)
+			if tt.wantReconnect == "" {
+				if !errors.Is(err, errAlreadyRunning) {
+					t.Errorf("start() error = %v, want the running connection kept", err)
+				}
+				if len(changed) != 0 {
+					t.Errorf("changedSettings() = %q, want none", changed)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("start() error = %v, want a reconnect", err)
+			}
+			if !slices.Equal(changed, []string{tt.wantReconnect}) {
+				t.Errorf("changedSettings() = %q, want [%q]", changed, tt.wantReconnect)
+			}
+		})
+	}
+}
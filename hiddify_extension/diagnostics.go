@@ -0,0 +1,74 @@
+package hiddify_extension
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Maximum time allowed for all diagnostic commands together
+const diagnosticsTimeout = 10 * time.Second
+
+// Default commands used to identify the remote host
+const defaultDiagnosticCommands = "id\nhostname\nuname -a"
+
+// runDiagnostics prints the output of the diagnostic commands; failures never abort the connection
+func (e *HiddifyExtensionSimpleSsh) runDiagnostics(ctx context.Context, client *ssh.Client) {
+	ctx, cancel := context.WithTimeout(ctx, diagnosticsTimeout)
+	defer cancel()
+
+	tokens := e.commandTokens()
+	for _, command := range splitLines(e.data().DiagnosticCommands) {
+		command, err := expandTokens(command, tokens)
+		if err != nil {
+			e.addAndUpdateConsole(yellow.Sprint("Diagnostic skipped: "), err.Error())
+			continue
+		}
+		output, err := runCommand(ctx, client, command)
+		if err != nil {
+			e.addAndUpdateConsole(yellow.Sprintf("Diagnostic %q failed: ", command), sanitizeText(err.Error()))
+			continue
+		}
+		e.addAndUpdateConsole(yellow.Sprintf("Diagnostic %q:\n", command), strings.TrimRight(sanitizeText(string(output)), "\n"))
+	}
+}
+
+// runCommand runs a command in a new session and aborts it when the context is done
+func runCommand(ctx context.Context, client *ssh.Client, command string) ([]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := session.CombinedOutput(command)
+		done <- result{output, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.output, r.err
+	case <-ctx.Done():
+		session.Close() // Unblock the running command
+		return nil, ctx.Err()
+	}
+}
+
+// splitLines returns the non-empty trimmed lines of a multi-line value
+func splitLines(value string) []string {
+	var lines []string
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,80 @@
+package hiddify_extension
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Dialer opens SSH client connections. The default implementation reaches the server over
+// the configured transport using golang.org/x/crypto/ssh; tests can substitute a fake that
+// hands out clients connected to an in-memory server or returns canned errors.
+type Dialer interface {
+	DialSSH(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error)
+}
+
+// DialerFunc adapts an ordinary function to the Dialer interface
+type DialerFunc func(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error)
+
+// DialSSH calls f(ctx, address, config)
+func (f DialerFunc) DialSSH(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	return f(ctx, address, config)
+}
+
+// StreamDialer returns a Dialer that performs the SSH handshake over a stream opened by open,
+// such as a pipe or a connection from the embedding application's own transport. The stream
+// is closed together with the SSH client.
+func StreamDialer(open func(ctx context.Context) (io.ReadWriteCloser, error)) Dialer {
+	return DialerFunc(func(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		stream, err := open(ctx)
+		if err != nil {
+			return nil, err
+		}
+		conn, ok := stream.(net.Conn)
+		if !ok {
+			conn = streamConn{stream}
+		}
+
+		c, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return ssh.NewClient(c, chans, reqs), nil
+	})
+}
+
+// streamConn adapts a plain stream to net.Conn; it has no addresses and ignores deadlines
+type streamConn struct {
+	io.ReadWriteCloser
+}
+
+// streamAddr is the address reported for a stream
+type streamAddr struct{}
+
+// Network and String describe a stream address
+func (streamAddr) Network() string { return "stream" }
+func (streamAddr) String() string  { return "stream" }
+
+// Address and deadline methods complete the net.Conn interface
+func (streamConn) LocalAddr() net.Addr                { return streamAddr{} }
+func (streamConn) RemoteAddr() net.Addr               { return streamAddr{} }
+func (streamConn) SetDeadline(t time.Time) error      { return nil }
+func (streamConn) SetReadDeadline(t time.Time) error  { return nil }
+func (streamConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// SetDialer replaces the dialer used for new connections; nil restores the default
+func (e *HiddifyExtensionSimpleSsh) SetDialer(dialer Dialer) {
+	e.dialer = dialer
+}
+
+// dial connects to the SSH server with the configured dialer
+func (e *HiddifyExtensionSimpleSsh) dial(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if e.dialer != nil {
+		return e.dialer.DialSSH(ctx, address, config)
+	}
+	return e.dialSSH(ctx, address, config)
+}
@@ -0,0 +1,351 @@
+package hiddify_extension
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is an in-memory SSH server reached through the Dialer returned by dialer
+type testServer struct {
+	hostKey     ssh.Signer
+	password    string
+	failDials   atomic.Int32  // Upcoming dials that fail with a network error
+	dials       atomic.Int32  // Dials made so far
+	next        *testServer   // Server reached through this one as a jump host, if any
+	silent      bool          // Leaves global requests unanswered, like a hung server
+	bannerDelay time.Duration // Time the server waits before sending its banner
+
+	mu        sync.Mutex
+	passwords []string // Passwords offered by clients
+	keys      []string // Fingerprints of the public keys offered by clients, which are refused
+}
+
+// newTestServer starts a server with a fresh ed25519 host key that accepts password
+func newTestServer(t *testing.T, password string) *testServer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{hostKey: signer, password: password}
+}
+
+// dialer connects clients to the server over net.Pipe, without touching the network
+func (s *testServer) dialer() Dialer {
+	return DialerFunc(func(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		s.dials.Add(1)
+		if s.failDials.Add(-1) >= 0 {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+		}
+		client, server := net.Pipe()
+		go s.serve(newQueuedConn(server))
+		c, chans, reqs, err := ssh.NewClientConn(client, address, config)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		return ssh.NewClient(c, chans, reqs), nil
+	})
+}
+
+// queuedConn sends writes from a goroutine. Both ends of an SSH connection send their version
+// before reading, which blocks forever on an unbuffered net.Pipe unless one end queues.
+type queuedConn struct {
+	net.Conn
+	writes chan []byte
+	closed chan struct{}
+	once   sync.Once
+}
+
+// newQueuedConn starts sending the writes to conn in order, until it is closed
+func newQueuedConn(conn net.Conn) *queuedConn {
+	c := &queuedConn{Conn: conn, writes: make(chan []byte, 64), closed: make(chan struct{})}
+	go func() {
+		for {
+			select {
+			case p := <-c.writes:
+				if _, err := conn.Write(p); err != nil {
+					c.Close()
+				}
+			case <-c.closed:
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// Write queues a copy of p
+func (c *queuedConn) Write(p []byte) (int, error) {
+	select {
+	case c.writes <- append([]byte(nil), p...):
+		return len(p), nil
+	case <-c.closed:
+		return 0, net.ErrClosed
+	}
+}
+
+// Close stops the writes and closes the connection
+func (c *queuedConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// serve runs the server side of one connection. Channels are refused, except forwarded
+// connections when the server is a jump host to next.
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	time.Sleep(s.bannerDelay)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			s.mu.Lock()
+			s.passwords = append(s.passwords, string(password))
+			s.mu.Unlock()
+			if string(password) == s.password {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			s.mu.Lock()
+			s.keys = append(s.keys, ssh.FingerprintSHA256(key))
+			s.mu.Unlock()
+			return nil, errors.New("public keys are refused")
+		},
+	}
+	config.AddHostKey(s.hostKey)
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer sconn.Close()
+	if s.silent {
+		go func() {
+			for range reqs {
+			}
+		}()
+	} else {
+		go ssh.DiscardRequests(reqs)
+	}
+	for ch := range chans {
+		if ch.ChannelType() != "direct-tcpip" || s.next == nil {
+			ch.Reject(ssh.Prohibited, "no channels in tests")
+			continue
+		}
+		channel, requests, err := ch.Accept()
+		if err != nil {
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go s.next.serve(newQueuedConn(channelConn{Channel: channel}))
+	}
+}
+
+// offered returns the passwords clients offered so far
+func (s *testServer) offered() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.passwords)
+}
+
+// offeredKeys returns the fingerprints of the public keys clients offered so far
+func (s *testServer) offeredKeys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Compact(slices.Clone(s.keys))
+}
+
+// channelConn serves an SSH channel as a net.Conn
+type channelConn struct {
+	ssh.Channel
+}
+
+func (channelConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (channelConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (channelConn) SetDeadline(t time.Time) error      { return nil }
+func (channelConn) SetReadDeadline(t time.Time) error  { return nil }
+func (channelConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// pin returns the server's host key in the format of the pinned host keys
+func (s *testServer) pin() string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(s.hostKey.PublicKey())))
+}
+
+// newTestExtension returns an extension that reaches server through its fake dialer. The form is
+// not shown, so nothing is sent to the host and the console is only buffered.
+func newTestExtension(t *testing.T, server *testServer) *HiddifyExtensionSimpleSsh {
+	t.Helper()
+	e := NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh)
+	e.SetDialer(server.dialer())
+	e.Base.Data.IP = "ssh.test"
+	e.Base.Data.Username = "user"
+	e.Base.Data.Password = server.password
+	e.Base.Data.HostKeys = server.pin()
+	e.Base.Data.ConnectRate = 0 // Tests share the extension-wide throttle
+	t.Cleanup(func() { e.Stop() })
+	return e
+}
+
+func TestConnect(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+
+	client, err := e.connect(context.Background())
+	if err != nil {
+		t.Fatalf("connect() error = %v", err)
+	}
+	client.Close()
+	if !strings.Contains(e.consoleText(), "Host key matched") {
+		t.Errorf("console does not report the pinned key match:\n%s", e.consoleText())
+	}
+}
+
+func TestConnectAuthFailure(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+	e.Base.Data.Password = "wrong"
+
+	_, err := e.connect(context.Background())
+	if err == nil {
+		t.Fatal("connect() succeeded with a wrong password")
+	}
+	if kind, permanent := classifyConnectError(err); kind != "authentication" || !permanent {
+		t.Errorf("classifyConnectError() = %q, %v, want a permanent authentication failure", kind, permanent)
+	}
+	if dials := server.dials.Load(); dials != 1 {
+		t.Errorf("dialed %d times, authentication failures must not be retried", dials)
+	}
+}
+
+func TestConnectHostKeyMismatch(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+	e.Base.Data.HostKeys = newTestServer(t, "").pin()
+
+	_, err := e.connect(context.Background())
+	var hostKeyErr *hostKeyError
+	if !errors.As(err, &hostKeyErr) {
+		t.Fatalf("connect() error = %v, want a host key error", err)
+	}
+	if dials := server.dials.Load(); dials != 1 {
+		t.Errorf("dialed %d times, host key failures must not be retried", dials)
+	}
+}
+
+func TestConnectPinnedKeys(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+	first, second, third := server.hostKey, newTestServer(t, "").hostKey, newTestServer(t, "").hostKey
+	e.Base.Data.HostKeys = server.pin() + "\n" + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(second.PublicKey())))
+
+	// A server with several host keys, e.g. during a key rotation, may present any pinned one
+	for _, key := range []ssh.Signer{first, second} {
+		server.hostKey = key
+		client, err := e.connect(context.Background())
+		if err != nil {
+			t.Fatalf("connect() with %s error = %v", ssh.FingerprintSHA256(key.PublicKey()), err)
+		}
+		client.Close()
+	}
+
+	server.hostKey = third
+	_, err := e.connect(context.Background())
+	var hostKeyErr *hostKeyError
+	if !errors.As(err, &hostKeyErr) {
+		t.Fatalf("connect() with an unpinned key error = %v, want a host key error", err)
+	}
+	if strings.Contains(e.data().HostKeys, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(third.PublicKey())))) {
+		t.Error("the rejected key was pinned")
+	}
+}
+
+func TestSetHostKeyCallback(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+	e.Base.Data.HostKeys = newTestServer(t, "").pin() // The built-in check would reject the server
+	t.Cleanup(func() { SetHostKeyCallback(nil) })
+
+	var presented []string
+	rejected := errors.New("not in the trust store")
+	var reject bool
+	SetHostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		presented = append(presented, ssh.FingerprintSHA256(key))
+		if reject {
+			return rejected
+		}
+		return nil
+	})
+
+	client, err := e.connect(context.Background())
+	if err != nil {
+		t.Fatalf("connect() error = %v, want the custom callback to replace the pinned keys", err)
+	}
+	client.Close()
+	if want := ssh.FingerprintSHA256(server.hostKey.PublicKey()); !slices.Equal(presented, []string{want}) {
+		t.Errorf("custom callback saw %q, want the server key %q", presented, want)
+	}
+
+	reject = true
+	if _, err := e.connect(context.Background()); !errors.Is(err, rejected) {
+		t.Errorf("connect() error = %v, want the custom callback's error", err)
+	}
+
+	SetHostKeyCallback(nil)
+	presented = nil
+	var hostKeyErr *hostKeyError
+	if _, err := e.connect(context.Background()); !errors.As(err, &hostKeyErr) || errors.Is(err, rejected) {
+		t.Errorf("connect() error = %v, want the pinned key mismatch again", err)
+	}
+	if len(presented) != 0 {
+		t.Error("the cleared custom callback was still called")
+	}
+}
+
+func TestConnectRetry(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+	e.Base.Data.ConnectAttempts = 2
+	server.failDials.Store(1)
+
+	start := time.Now()
+	client, err := e.connect(context.Background())
+	if err != nil {
+		t.Fatalf("connect() error = %v", err)
+	}
+	client.Close()
+	if dials := server.dials.Load(); dials != 2 {
+		t.Errorf("dialed %d times, want one failure and one retry", dials)
+	}
+	if elapsed := time.Since(start); elapsed < retryDelay(1) {
+		t.Errorf("retried after %v, want at least %v", elapsed, retryDelay(1))
+	}
+}
+
+func TestConnectRetryGivesUp(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+	e.Base.Data.ConnectAttempts = 1
+	server.failDials.Store(1)
+
+	if _, err := e.connect(context.Background()); err == nil {
+		t.Fatal("connect() succeeded after every attempt failed")
+	}
+	if dials := server.dials.Load(); dials != 1 {
+		t.Errorf("dialed %d times, want a single attempt", dials)
+	}
+}
@@ -0,0 +1,67 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Matches the error golang.org/x/crypto/ssh returns for SSH_MSG_DISCONNECT, whose type is unexported
+var disconnectPattern = regexp.MustCompile(`ssh: disconnect, reason (\d+): (.*)`)
+
+// disconnectReason describes a standard SSH disconnect reason code (RFC 4253, section 11.1)
+type disconnectReason struct {
+	description string
+	permanent   bool // Reconnecting is not expected to help
+}
+
+// Standard disconnect reason codes
+var disconnectReasons = map[int]disconnectReason{
+	1:  {"host not allowed to connect", true},
+	2:  {"protocol error", false},
+	3:  {"key exchange failed", true},
+	4:  {"reserved", false},
+	5:  {"MAC error", false},
+	6:  {"compression error", false},
+	7:  {"service not available", true},
+	8:  {"protocol version not supported", true},
+	9:  {"host key not verifiable", true},
+	10: {"connection lost", false},
+	11: {"disconnected by application", false},
+	12: {"too many connections", false},
+	13: {"authentication cancelled by user", true},
+	14: {"no more authentication methods available", true},
+	15: {"illegal user name", true},
+}
+
+// serverDisconnect extracts the reason of a server-initiated disconnect from err. The description
+// is empty when err is not a disconnect.
+func serverDisconnect(err error) (description string, permanent bool) {
+	if err == nil {
+		return "", false
+	}
+	match := disconnectPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "", false
+	}
+	code, _ := strconv.Atoi(match[1])
+	reason, ok := disconnectReasons[code]
+	if !ok {
+		reason = disconnectReason{description: "unknown reason", permanent: false}
+	}
+	description = fmt.Sprintf("%s (reason %d)", reason.description, code)
+	if match[2] != "" {
+		description += ": " + sanitizeText(match[2]) // The message is chosen by the server
+	}
+	return description, reason.permanent
+}
+
+// watchDisconnect logs the reason when the server closes the connection with a disconnect message,
+// which sessions otherwise only report as EOF
+func (e *HiddifyExtensionSimpleSsh) watchDisconnect(client *ssh.Client) {
+	if description, _ := serverDisconnect(client.Wait()); description != "" {
+		e.addAndUpdateConsole(red.Sprint("Server disconnected: "), description)
+	}
+}
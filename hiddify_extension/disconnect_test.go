@@ -0,0 +1,59 @@
+package hiddify_extension
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerDisconnect(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantDesc      string
+		wantPermanent bool
+	}{
+		{"well formed", errors.New("ssh: disconnect, reason 14: no more methods"), "no more authentication methods available (reason 14): no more methods", true},
+		{"transient", errors.New("ssh: disconnect, reason 11: bye"), "disconnected by application (reason 11): bye", false},
+		{"no message", errors.New("ssh: disconnect, reason 2: "), "protocol error (reason 2)", false},
+		{"unknown code", errors.New("ssh: disconnect, reason 99: later"), "unknown reason (reason 99): later", false},
+		{"control characters", errors.New("ssh: disconnect, reason 12: full\x1b[2J"), `too many connections (reason 12): full\x1b[2J`, false},
+		{"not a disconnect", errors.New("EOF"), "", false},
+		{"other ssh error", errors.New("ssh: handshake failed: reason 3"), "", false},
+		{"nil", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc, permanent := serverDisconnect(tt.err)
+			if desc != tt.wantDesc || permanent != tt.wantPermanent {
+				t.Errorf("serverDisconnect() = %q, %v, want %q, %v", desc, permanent, tt.wantDesc, tt.wantPermanent)
+			}
+		})
+	}
+}
+
+func TestWatchDisconnectPlainClose(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+	client, err := e.connect(context.Background())
+	if err != nil {
+		t.Fatalf("connect() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		e.watchDisconnect(client)
+		close(done)
+	}()
+	client.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchDisconnect() kept waiting after the connection closed")
+	}
+	if strings.Contains(e.consoleText(), "Server disconnected") {
+		t.Errorf("console reports a disconnect reason for a plain close:\n%s", e.consoleText())
+	}
+}
@@ -0,0 +1,38 @@
+package hiddify_extension
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// Largest DSCP value, the 6 high bits of the IP TOS byte
+const maxDSCP = 63
+
+// Returned by setTOS on platforms without socket TOS support
+var errDSCPUnsupported = errors.New("DSCP marking is not supported on this platform")
+
+// dscpControl returns a net.Dialer control function that marks sockets with the configured DSCP
+// value, or nil when marking is disabled. Failures are logged and never abort the connection.
+func (e *HiddifyExtensionSimpleSsh) dscpControl() func(network string, address string, c syscall.RawConn) error {
+	dscp := e.data().DSCP
+	if dscp == 0 {
+		return nil
+	}
+	tos := dscp << 2 // The low 2 bits are used for ECN
+	return func(network string, address string, c syscall.RawConn) error {
+		var err error
+		if controlErr := c.Control(func(fd uintptr) { err = setTOS(network, fd, tos) }); controlErr != nil {
+			err = controlErr
+		}
+		switch {
+		case errors.Is(err, errDSCPUnsupported):
+			e.addAndUpdateConsole(yellow.Sprint("DSCP: "), "not supported on this platform, skipping")
+		case err != nil:
+			e.addAndUpdateConsole(red.Sprint("Failed to set DSCP: "), err.Error())
+		default:
+			e.addAndUpdateConsole(yellow.Sprint("DSCP: "), fmt.Sprintf("%d (TOS 0x%02x) on %s", dscp, tos, address))
+		}
+		return nil
+	}
+}
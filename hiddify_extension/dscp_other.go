@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package hiddify_extension
+
+// setTOS reports that socket TOS marking is not available
+func setTOS(network string, fd uintptr, tos int) error {
+	return errDSCPUnsupported
+}
@@ -0,0 +1,13 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package hiddify_extension
+
+import "syscall"
+
+// setTOS sets the TOS byte, or the traffic class for IPv6, of a socket
+func setTOS(network string, fd uintptr, tos int) error {
+	if network == "tcp6" || network == "udp6" {
+		return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos)
+	}
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+}
@@ -0,0 +1,16 @@
+package hiddify_extension
+
+import (
+	"strings"
+)
+
+// connectErrorHint returns advice for well-known connection failures, or an empty string
+func connectErrorHint(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "Too many authentication failures"):
+		return "the server disconnected after too many authentication attempts; lower \"Max Keys Offered\" or paste the exact private key to use"
+	default:
+		return ""
+	}
+}
@@ -1,8 +1,14 @@
 package hiddify_extension
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fatih/color"
@@ -18,132 +24,1459 @@ var (
 	yellow = color.New(color.FgYellow)
 )
 
-// Extension-specific data struct
+// Extension-specific data struct. The reload tag marks whether changing a field rebuilds a running
+// connection ("reconnect") or is picked up where it is used ("live").
 type HiddifyExtensionSimpleSshData struct {
-	IP       string `json:"ip"`       // SSH server IP
-	Port     string `json:"port"`     // SSH port
-	Username string `json:"username"` // SSH username
-	Password string `json:"password"` // SSH password
-	Command  string `json:"command"`  // Command to execute on SSH server
+	IP            string `json:"ip" reload:"reconnect"`             // SSH server IP
+	Port          string `json:"port" reload:"reconnect"`           // SSH port
+	FallbackPorts string `json:"fallback_ports" reload:"reconnect"` // Comma-separated ports tried in order when Port fails
+	Username      string `json:"username" reload:"reconnect"`       // SSH username
+	Password      string `json:"password" reload:"reconnect"`       // SSH password
+	PrivateKey    string `json:"private_key" reload:"reconnect"`    // SSH private keys (OpenSSH, PEM or PuTTY .ppk)
+	Passphrase    string `json:"passphrase" reload:"reconnect"`     // Passphrase for an encrypted private key
+	KeyType       string `json:"key_type" reload:"live"`            // Type of generated key pairs
+	UseAgent      bool   `json:"use_agent" reload:"reconnect"`      // Authenticate with keys from the local SSH agent
+	ForwardAgent  bool   `json:"forward_agent" reload:"reconnect"`  // Forward the local SSH agent to commands and shells
+	MaxKeys       int    `json:"max_keys" reload:"reconnect"`       // Maximum number of keys offered to the server (0 for no limit)
+	Command       string `json:"command" reload:"reconnect"`        // Command to execute on SSH server
+	Mode          string `json:"mode" reload:"reconnect"`           // Run the command, open an interactive shell or request a subsystem
+	Subsystem     string `json:"subsystem" reload:"reconnect"`      // Subsystem requested in subsystem mode
+
+	LatencySamples    int    `json:"latency_samples" reload:"live"`          // Number of latency samples shown in the sparkline
+	SpeedTestMB       int    `json:"speed_test_mb" reload:"live"`            // MiB moved in each direction by the speed test
+	AlgorithmPreset   string `json:"algorithm_preset" reload:"reconnect"`    // Preset of ciphers, key exchanges, MACs and host key algorithms
+	Ciphers           string `json:"ciphers" reload:"reconnect"`             // Comma-separated ciphers overriding the preset
+	KeyExchanges      string `json:"key_exchanges" reload:"reconnect"`       // Comma-separated key exchanges overriding the preset
+	MACs              string `json:"macs" reload:"reconnect"`                // Comma-separated MACs overriding the preset
+	HostKeyAlgorithms string `json:"host_key_algorithms" reload:"reconnect"` // Comma-separated host key algorithms to accept
+	HostKeys          string `json:"host_keys" reload:"reconnect"`           // Pinned server host keys or fingerprints, one per line
+	TrustPolicy       string `json:"trust_policy" reload:"reconnect"`        // How a server without pinned keys or known_hosts is trusted
+	RekeyThreshold    int64  `json:"rekey_threshold" reload:"reconnect"`     // Bytes sent before rekeying (0 for the cipher's default)
+	KnownHostsFile    string `json:"known_hosts_file" reload:"reconnect"`    // known_hosts file the server key is checked against (empty disables)
+	FingerprintFormat string `json:"fingerprint_format" reload:"live"`       // Host key fingerprint format shown in the console
+	KnownHostsMatch   string `json:"known_hosts_match" reload:"reconnect"`   // Match known_hosts entries by hostname, IP or both
+
+	Transport        string `json:"transport" reload:"reconnect"`           // Transport used to reach the SSH server
+	WebSocketURL     string `json:"websocket_url" reload:"reconnect"`       // WebSocket URL for the WebSocket transport
+	TLSServerName    string `json:"tls_server_name" reload:"reconnect"`     // SNI sent by the TLS transport
+	InsecureTLS      bool   `json:"insecure_tls" reload:"reconnect"`        // Skip TLS certificate verification
+	LocalDNS         string `json:"local_dns" reload:"reconnect"`           // Comma-separated DNS servers used to resolve the server locally
+	PinResolvedIP    bool   `json:"pin_resolved_ip" reload:"reconnect"`     // Keep the first resolved server IP for retries and reconnects
+	ReverseDNS       bool   `json:"reverse_dns" reload:"live"`              // Show reverse DNS names of connected addresses in the console
+	PortCheck        bool   `json:"port_check" reload:"live"`               // Check the SSH port is reachable before the handshake
+	DSCP             int    `json:"dscp" reload:"reconnect"`                // DSCP value marked on the SSH socket (0 leaves it unmarked)
+	UseSystemProxy   bool   `json:"use_system_proxy" reload:"reconnect"`    // Honor HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	SplitTunnelRules string `json:"split_tunnel_rules" reload:"live"`       // domain:, process: or package: lines routed through the sing-box SSH outbound
+	UpstreamOutbound string `json:"upstream_outbound" reload:"live"`        // Tag of the sing-box outbound the SSH outbound dials through (empty dials directly)
+	JumpHosts        string `json:"jump_hosts" reload:"reconnect"`          // Comma-separated jump hosts passed through in order
+	JumpPassword     string `json:"jump_password" reload:"reconnect"`       // Password for the jump hosts
+	JumpShareAuth    bool   `json:"jump_share_password" reload:"reconnect"` // Offer the server password to jump hosts when no jump host password is set
+
+	Diagnostics        bool   `json:"diagnostics" reload:"live"`         // Run identity diagnostics after connecting
+	DiagnosticCommands string `json:"diagnostic_commands" reload:"live"` // Diagnostic commands, one per line
+
+	PostConnectSteps   string `json:"post_connect_steps" reload:"reconnect"`    // Remote commands run in order after connecting, one per line
+	AbortOnStepFailure bool   `json:"abort_on_step_failure" reload:"reconnect"` // Stop at the first failed step and skip the command or shell
+
+	Greeting     string `json:"greeting" reload:"live"`      // Custom welcome message shown at the top of the console
+	ConsoleWidth int    `json:"console_width" reload:"live"` // Longest console line in characters (0 for no limit)
+	ConsoleWrap  bool   `json:"console_wrap" reload:"live"`  // Wrap long console lines instead of truncating them
+
+	ServerAliveInterval int `json:"server_alive_interval" reload:"live"`  // Seconds between keepalive probes (0 disables)
+	ServerAliveCountMax int `json:"server_alive_count_max" reload:"live"` // Unanswered probes before the connection is dropped
+
+	ConnectAttempts   int  `json:"connect_attempts" reload:"live"`    // Connection attempts before giving up
+	ConnectRate       int  `json:"connect_rate" reload:"live"`        // Connect attempts per second across the extension (0 for no limit)
+	ConnectTimeout    int  `json:"connect_timeout" reload:"live"`     // Seconds allowed for the first connection attempt
+	ConnectTimeoutMax int  `json:"connect_timeout_max" reload:"live"` // Seconds allowed for later attempts, doubling up to this
+	HandshakeTimeout  int  `json:"handshake_timeout" reload:"live"`   // Seconds allowed for the SSH handshake once connected (0 for no limit)
+	RetryAuthErrors   bool `json:"retry_auth_errors" reload:"live"`   // Also retry authentication and host key failures
+	WaitForConnect    bool `json:"wait_for_connect" reload:"live"`    // Make submit wait for the connection and return its error
+	HealthPort        int  `json:"health_port" reload:"live"`         // Local port serving /healthz and /ready (0 disables)
+
+	GlobalRequest        string `json:"global_request" reload:"live"`         // Name of a global request sent after connecting
+	GlobalRequestPayload string `json:"global_request_payload" reload:"live"` // Optional payload of the global request
+
+	MTUProbe       bool   `json:"mtu_probe" reload:"live"`        // Probe for MTU blackholes after connecting
+	MTUProbeTarget string `json:"mtu_probe_target" reload:"live"` // Echo service (host:port) reached through the tunnel
+	MTUProbeMin    int    `json:"mtu_probe_min" reload:"live"`    // Smallest payload size in bytes
+	MTUProbeMax    int    `json:"mtu_probe_max" reload:"live"`    // Largest payload size in bytes
+
+	ShellColumns int `json:"shell_columns" reload:"live"` // Terminal width of the interactive shell
+	ShellRows    int `json:"shell_rows" reload:"live"`    // Terminal height of the interactive shell
+
+	RecordTranscript bool `json:"record_transcript" reload:"live"` // Record session input and output for later review
+	TranscriptMaxKB  int  `json:"transcript_max_kb" reload:"live"` // Size in KiB of the kept transcript
+
+	LogFilePath  string `json:"log_file_path" reload:"live"`   // File the console output is mirrored to (empty disables)
+	LogMaxSizeKB int    `json:"log_max_size_kb" reload:"live"` // Size in KiB at which the log file is rotated
+	LogMaxFiles  int    `json:"log_max_files" reload:"live"`   // Number of rotated log files kept
+	HostLog      bool   `json:"host_log" reload:"live"`        // Mirror console output to the app's global log
+
+	TraceFilePath  string `json:"trace_file_path" reload:"live"`   // JSONL file connection records are written to (empty disables)
+	TraceMaxSizeKB int    `json:"trace_max_size_kb" reload:"live"` // Size in KiB at which the trace file is rotated
 }
 
 // Form field keys
 const (
-	IPKey       = "ip"
-	PortKey     = "port"
-	UsernameKey = "username"
-	PasswordKey = "password"
-	CommandKey  = "command"
+	IPKey            = "ip"
+	PortKey          = "port"
+	FallbackPortsKey = "fallback_ports"
+	UsernameKey      = "username"
+	PasswordKey      = "password"
+	PrivateKeyKey    = "private_key"
+	PassphraseKey    = "passphrase"
+	KeyTypeKey       = "key_type"
+	UseAgentKey      = "use_agent"
+	ForwardAgentKey  = "forward_agent"
+	MaxKeysKey       = "max_keys"
+	CommandKey       = "command"
+	ModeKey          = "mode"
+	SubsystemKey     = "subsystem"
+	ActionKey        = "action"
+
+	LatencySamplesKey    = "latency_samples"
+	SpeedTestMBKey       = "speed_test_mb"
+	AlgorithmPresetKey   = "algorithm_preset"
+	CiphersKey           = "ciphers"
+	KeyExchangesKey      = "key_exchanges"
+	MACsKey              = "macs"
+	HostKeyAlgorithmsKey = "host_key_algorithms"
+	HostKeysKey          = "host_keys"
+	HostKeysImportKey    = "host_keys_import"
+	TrustPolicyKey       = "trust_policy"
+	RekeyThresholdKey    = "rekey_threshold"
+	KnownHostsFileKey    = "known_hosts_file"
+	KnownHostsMatchKey   = "known_hosts_match"
+	FingerprintFormatKey = "fingerprint_format"
+
+	TransportKey        = "transport"
+	WebSocketURLKey     = "websocket_url"
+	TLSServerNameKey    = "tls_server_name"
+	InsecureTLSKey      = "insecure_tls"
+	LocalDNSKey         = "local_dns"
+	PinResolvedIPKey    = "pin_resolved_ip"
+	ReverseDNSKey       = "reverse_dns"
+	PortCheckKey        = "port_check"
+	DSCPKey             = "dscp"
+	UseSystemProxyKey   = "use_system_proxy"
+	JumpHostsKey        = "jump_hosts"
+	JumpPasswordKey     = "jump_password"
+	JumpShareAuthKey    = "jump_share_password"
+	SplitTunnelRulesKey = "split_tunnel_rules"
+	UpstreamOutboundKey = "upstream_outbound"
+
+	DiagnosticsKey        = "diagnostics"
+	DiagnosticCommandsKey = "diagnostic_commands"
+	PostConnectStepsKey   = "post_connect_steps"
+	AbortOnStepFailureKey = "abort_on_step_failure"
+
+	GreetingKey     = "greeting"
+	ConsoleWidthKey = "console_width"
+	ConsoleWrapKey  = "console_wrap"
+
+	ServerAliveIntervalKey = "server_alive_interval"
+	ServerAliveCountMaxKey = "server_alive_count_max"
+
+	ConnectAttemptsKey   = "connect_attempts"
+	ConnectRateKey       = "connect_rate"
+	ConnectTimeoutKey    = "connect_timeout"
+	ConnectTimeoutMaxKey = "connect_timeout_max"
+	HandshakeTimeoutKey  = "handshake_timeout"
+	HealthPortKey        = "health_port"
+	RetryAuthErrorsKey   = "retry_auth_errors"
+	WaitForConnectKey    = "wait_for_connect"
+
+	GlobalRequestKey        = "global_request"
+	GlobalRequestPayloadKey = "global_request_payload"
+
+	MTUProbeKey       = "mtu_probe"
+	MTUProbeTargetKey = "mtu_probe_target"
+	MTUProbeMinKey    = "mtu_probe_min"
+	MTUProbeMaxKey    = "mtu_probe_max"
+
+	ShellColumnsKey = "shell_columns"
+	ShellRowsKey    = "shell_rows"
+	ShellInputKey   = "shell_input"
+
+	RecordTranscriptKey = "record_transcript"
+	TranscriptMaxKBKey  = "transcript_max_kb"
+
+	LogFilePathKey  = "log_file_path"
+	LogMaxSizeKBKey = "log_max_size_kb"
+	LogMaxFilesKey  = "log_max_files"
+	HostLogKey      = "host_log"
+
+	TraceFilePathKey  = "trace_file_path"
+	TraceMaxSizeKBKey = "trace_max_size_kb"
 )
 
+// Actions performed on submit
+const (
+	ActionRun          = "run"
+	ActionOutboundJSON = "outbound_json"
+	ActionTranscript   = "transcript"
+	ActionGenerateKey  = "generate_key"
+	ActionInstallKey   = "install_key"
+	ActionSelfCheck    = "self_check"
+	ActionHostKey      = "host_key"
+	ActionAdvanced     = "advanced"
+	ActionSpeedTest    = "speed_test"
+	ActionExportKeys   = "export_host_keys"
+	ActionImportKeys   = "import_host_keys"
+	ActionTrustHostKey = "trust_host_key"
+)
+
+// Welcome message used when no custom greeting is set
+const defaultGreeting = "Ready to execute commands over SSH"
+
 // HiddifyExtensionSimpleSsh represents the extension's core functionality
 type HiddifyExtensionSimpleSsh struct {
 	ex.Base[HiddifyExtensionSimpleSshData]
-	console string             // Stores console output
-	cancel  context.CancelFunc // Function to cancel background tasks
+	lifecycle    lifecycle           // Background task state
+	latencies    *latencyHistory     // Recent handshake latencies
+	workingPort  atomic.Value        // Port of the last successful connection, tried first on reconnect
+	logFile      rotatingLog         // Log file the console is mirrored to
+	traceFile    rotatingLog         // Connection trace file
+	dialer       Dialer              // Dialer override, nil for the built-in transports
+	transcript   transcript          // Recorded session input and output
+	presentedKey presentedHostKey    // Host key presented on the last connection
+	pinned       pinnedIP            // Server IP kept for retries and reconnects
+	health       healthServer        // Local health endpoints
+	reverseDNS   reverseNames        // Cached reverse DNS names for the console
+	formActive   atomic.Bool         // Whether the host is showing the form
+	toHost       func(ui.Form) error // Receives forms and dialogs instead of the host's queue, set by tests
+	speedTesting atomic.Bool         // Whether a speed test is running
+	showAdvanced atomic.Bool         // Whether the advanced settings are shown, not persisted
+
+	shellMu     sync.Mutex    // Guards the interactive shell state
+	shell       *shellSession // Open interactive shell, if any
+	shellOutput string        // Recent interactive shell output
+
+	consoleMu sync.Mutex // Guards the console output, written by every task and rendered by the spinner
+	console   string     // Stores console output
+
+	progressMu    sync.Mutex // Guards the connect progress line
+	progressPhase string     // Current connect phase, empty when not connecting
+	progressFrame int        // Current spinner frame
+
+	dataMu sync.RWMutex // Guards Base.Data, written by submits, key generation and host key pinning while tasks read it
+}
+
+// data returns a copy of the settings. Tasks read settings through it where they use them, so
+// live fields apply right away and a submit never tears a read.
+func (e *HiddifyExtensionSimpleSsh) data() HiddifyExtensionSimpleSshData {
+	e.dataMu.RLock()
+	defer e.dataMu.RUnlock()
+	return e.Base.Data
 }
 
-// GetUI provides the form for user input
+// StoreData persists the settings, without racing a submit or a host key pinned while connecting
+func (e *HiddifyExtensionSimpleSsh) StoreData() {
+	e.dataMu.RLock()
+	defer e.dataMu.RUnlock()
+	e.Base.StoreData()
+}
+
+// GetUI provides the form for user input. The host calls it when it opens the form.
 func (e *HiddifyExtensionSimpleSsh) GetUI() ui.Form {
-	// UI form creation
-	return ui.Form{
-		Title:       "Simple SSH Command Executor",
-		Description: "Execute a command on a remote SSH server",
-		Buttons:     []string{ui.Button_Cancel, ui.Button_Submit},
-		Fields: []ui.FormField{
-			{
-				Type:        ui.FieldInput,
-				Key:         IPKey,
-				Label:       "IP Address",
-				Placeholder: "Enter the SSH server IP address",
-				Required:    true,
-				Value:       e.Base.Data.IP,
+	e.formActive.Store(true)
+	return e.form()
+}
+
+// UpdateUI sends the form to the host while it is shown. Updates are dropped once the form is
+// closed, since nobody reads them; the console keeps buffering and is shown when the form reopens.
+func (e *HiddifyExtensionSimpleSsh) UpdateUI(form ui.Form) error {
+	if !e.formActive.Load() {
+		return nil
+	}
+	if e.toHost != nil {
+		return e.toHost(form)
+	}
+	return e.Base.UpdateUI(form)
+}
+
+// ShowMessage shows a dialog with an OK button
+func (e *HiddifyExtensionSimpleSsh) ShowMessage(title string, msg string) error {
+	if e.toHost != nil {
+		return e.toHost(ui.Form{Title: title, Description: msg, Buttons: []string{ui.Button_Ok}})
+	}
+	return e.Base.ShowMessage(title, msg)
+}
+
+// settingsFields returns every settings field, including the advanced ones
+func (e *HiddifyExtensionSimpleSsh) settingsFields() []ui.FormField {
+	data := e.data()
+	return []ui.FormField{
+		{
+			Type:        ui.FieldInput,
+			Key:         IPKey,
+			Label:       "IP Address",
+			Placeholder: "SSH server IP address or host name",
+			Required:    true,
+			Value:       data.IP,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         PortKey,
+			Label:       "Port",
+			Placeholder: "Enter the SSH server port",
+			Required:    true,
+			Value:       data.Port,
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         FallbackPortsKey,
+			Label:       "Fallback Ports",
+			Placeholder: "Ports tried in order when the port above fails, e.g. 443, 80 (empty disables)",
+			Value:       data.FallbackPorts,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         UsernameKey,
+			Label:       "Username",
+			Placeholder: "Enter SSH username",
+			Required:    true,
+			Value:       data.Username,
+		},
+		{
+			Type:        ui.FieldPassword, // Hide password input
+			Key:         PasswordKey,
+			Label:       "Password",
+			Placeholder: "Enter SSH password",
+			Value:       data.Password,
+		},
+		{
+			Type:        ui.FieldTextArea,
+			Key:         PrivateKeyKey,
+			Label:       "Private Key",
+			Placeholder: "Paste one or more OpenSSH, PEM or PuTTY (.ppk) private keys",
+			Value:       data.PrivateKey,
+			Lines:       5,
+		},
+		{
+			Type:        ui.FieldPassword, // Hide passphrase input
+			Key:         PassphraseKey,
+			Label:       "Key Passphrase",
+			Placeholder: "Enter the private key passphrase (if encrypted)",
+			Value:       data.Passphrase,
+		},
+		{
+			Type:  ui.FieldSelect,
+			Key:   KeyTypeKey,
+			Label: "Generated Key Type (used by Generate key pair)",
+			Value: data.KeyType,
+			Items: []ui.SelectItem{
+				{Label: "Ed25519", Value: KeyTypeED25519},
+				{Label: "ECDSA P-256", Value: KeyTypeECDSA},
+				{Label: "RSA 3072", Value: KeyTypeRSA},
+			},
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   UseAgentKey,
+			Label: "Use SSH Agent (required for security keys)",
+			Value: strconv.FormatBool(data.UseAgent),
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   ForwardAgentKey,
+			Label: "Forward SSH Agent (the server can use your keys)",
+			Value: strconv.FormatBool(data.ForwardAgent),
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         MaxKeysKey,
+			Label:       "Max Keys Offered",
+			Placeholder: "Maximum keys tried before giving up (0 for no limit)",
+			Required:    true,
+			Value:       strconv.Itoa(data.MaxKeys),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         CommandKey,
+			Label:       "Command",
+			Placeholder: "Enter command to execute (%h host, %p port, %r user, %n configured host:port, %% for %)",
+			Required:    true,
+			Value:       data.Command,
+		},
+		{
+			Type:  ui.FieldSelect,
+			Key:   ModeKey,
+			Label: "Mode",
+			Value: data.Mode,
+			Items: []ui.SelectItem{
+				{Label: "Run command", Value: ModeCommand},
+				{Label: "Interactive shell", Value: ModeShell},
+				{Label: "Request subsystem", Value: ModeSubsystem},
 			},
-			{
-				Type:        ui.FieldInput,
-				Key:         PortKey,
-				Label:       "Port",
-				Placeholder: "Enter the SSH server port",
-				Required:    true,
-				Value:       e.Base.Data.Port,
-				Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         SubsystemKey,
+			Label:       "Subsystem",
+			Placeholder: "Subsystem requested in subsystem mode, e.g. sftp",
+			Required:    true,
+			Value:       data.Subsystem,
+		},
+		{
+			Type:  ui.FieldSelect,
+			Key:   ActionKey,
+			Label: "On Submit",
+			Value: ActionRun, // Not persisted, always starts on the default action
+			Items: []ui.SelectItem{
+				{Label: e.connectLabel(), Value: ActionRun},
+				{Label: "Show sing-box outbound JSON", Value: ActionOutboundJSON},
+				{Label: "Show session transcript", Value: ActionTranscript},
+				{Label: "Generate key pair", Value: ActionGenerateKey},
+				{Label: "Install public key on server (password login)", Value: ActionInstallKey},
+				{Label: "Self-check (goroutines and open files)", Value: ActionSelfCheck},
+				{Label: "Show server host key (fingerprints and randomart)", Value: ActionHostKey},
+				{Label: "Trust last host key (pin the key presented last)", Value: ActionTrustHostKey},
+				{Label: "Speed test (latency, download and upload)", Value: ActionSpeedTest},
+				{Label: "Export pinned host keys (known_hosts)", Value: ActionExportKeys},
+				{Label: "Import host keys (known_hosts)", Value: ActionImportKeys},
+				{Label: e.advancedLabel(), Value: ActionAdvanced},
 			},
-			{
-				Type:        ui.FieldInput,
-				Key:         UsernameKey,
-				Label:       "Username",
-				Placeholder: "Enter SSH username",
-				Required:    true,
-				Value:       e.Base.Data.Username,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         LatencySamplesKey,
+			Label:       "Latency Samples",
+			Placeholder: "Number of recent latencies shown in the graph",
+			Required:    true,
+			Value:       strconv.Itoa(data.LatencySamples),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         SpeedTestMBKey,
+			Label:       "Speed Test Size (MiB)",
+			Placeholder: fmt.Sprintf("MiB downloaded and uploaded by the speed test, at most %d", maxSpeedTestMB),
+			Required:    true,
+			Value:       strconv.Itoa(data.SpeedTestMB),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:  ui.FieldSelect,
+			Key:   AlgorithmPresetKey,
+			Label: "Algorithm Preset (offered ciphers, key exchanges and MACs)",
+			Value: data.AlgorithmPreset,
+			Items: []ui.SelectItem{
+				{Label: "Default", Value: PresetDefault},
+				{Label: "Modern (AEAD and curve25519 only)", Value: PresetModern},
+				{Label: "FIPS", Value: PresetFIPS},
+				{Label: "Legacy (older servers)", Value: PresetLegacy},
 			},
-			{
-				Type:        ui.FieldPassword, // Hide password input
-				Key:         PasswordKey,
-				Label:       "Password",
-				Placeholder: "Enter SSH password",
-				Required:    true,
-				Value:       e.Base.Data.Password,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         CiphersKey,
+			Label:       "Ciphers (advanced)",
+			Placeholder: "Comma-separated, overrides the preset (empty for the preset's)",
+			Value:       data.Ciphers,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         KeyExchangesKey,
+			Label:       "Key Exchanges (advanced)",
+			Placeholder: "Comma-separated, overrides the preset (empty for the preset's)",
+			Value:       data.KeyExchanges,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         MACsKey,
+			Label:       "MACs (advanced)",
+			Placeholder: "Comma-separated, overrides the preset (empty for the preset's)",
+			Value:       data.MACs,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         HostKeyAlgorithmsKey,
+			Label:       "Host Key Algorithms",
+			Placeholder: "Comma-separated, e.g. ssh-ed25519, overrides the preset (empty for the preset's)",
+			Value:       data.HostKeyAlgorithms,
+		},
+		{
+			Type:        ui.FieldTextArea,
+			Key:         HostKeysKey,
+			Label:       "Pinned Host Keys",
+			Placeholder: "One public key (ssh-ed25519 AAAA...) or SHA256: fingerprint per line; pin the next key too while rotating",
+			Value:       data.HostKeys,
+			Lines:       3,
+		},
+		{
+			Type:  ui.FieldSelect,
+			Key:   TrustPolicyKey,
+			Label: "Trust Policy (servers without pinned keys or known_hosts)",
+			Value: data.TrustPolicy,
+			Items: []ui.SelectItem{
+				{Label: "Ask before trusting the key", Value: TrustPolicyAsk},
+				{Label: "Trust and pin on first use (TOFU)", Value: TrustPolicyTOFU},
+				{Label: "Strict (refuse unverified keys)", Value: TrustPolicyStrict},
+			},
+		},
+		{
+			Type:        ui.FieldTextArea,
+			Key:         HostKeysImportKey,
+			Label:       "Import Host Keys",
+			Placeholder: "known_hosts entries to add to the pinned keys with \"Import host keys\"; entries for other hosts are skipped",
+			Lines:       3,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         RekeyThresholdKey,
+			Label:       "Rekey Threshold (bytes, advanced)",
+			Placeholder: "Bytes sent before new keys are negotiated (0 for the cipher's default)",
+			Required:    true,
+			Value:       strconv.FormatInt(data.RekeyThreshold, 10),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         KnownHostsFileKey,
+			Label:       "Known Hosts File",
+			Placeholder: "Path of a known_hosts file, e.g. ~/.ssh/known_hosts (empty disables)",
+			Value:       data.KnownHostsFile,
+		},
+		{
+			Type:  ui.FieldSelect,
+			Key:   KnownHostsMatchKey,
+			Label: "Known Hosts Matching (names looked up in the file)",
+			Value: data.KnownHostsMatch,
+			Items: []ui.SelectItem{
+				{Label: "Hostname", Value: KnownHostsMatchHostname},
+				{Label: "IP Address", Value: KnownHostsMatchIP},
+				{Label: "Hostname and IP (CheckHostIP)", Value: KnownHostsMatchBoth},
 			},
-			{
-				Type:        ui.FieldInput,
-				Key:         CommandKey,
-				Label:       "Command",
-				Placeholder: "Enter command to execute",
-				Required:    true,
-				Value:       e.Base.Data.Command,
+		},
+		{
+			Type:  ui.FieldSelect,
+			Key:   FingerprintFormatKey,
+			Label: "Host Key Fingerprint Format",
+			Value: data.FingerprintFormat,
+			Items: []ui.SelectItem{
+				{Label: "SHA256", Value: FingerprintSHA256},
+				{Label: "MD5 (legacy)", Value: FingerprintMD5},
+				{Label: "SHA256 and MD5", Value: FingerprintBoth},
 			},
-			{
-				Type:  ui.FieldConsole,
-				Key:   "console",
-				Label: "Console Output",
-				Value: e.console, // Display console output
-				Lines: 20,
+		},
+		{
+			Type:  ui.FieldSelect,
+			Key:   TransportKey,
+			Label: "Transport (how the SSH connection is carried)",
+			Value: data.Transport,
+			Items: []ui.SelectItem{
+				{Label: "TCP", Value: TransportTCP},
+				{Label: "WebSocket", Value: TransportWebSocket},
+				{Label: "TLS", Value: TransportTLS},
 			},
 		},
+		{
+			Type:        ui.FieldInput,
+			Key:         WebSocketURLKey,
+			Label:       "WebSocket URL",
+			Placeholder: "wss://example.com/ssh (WebSocket transport only)",
+			Value:       data.WebSocketURL,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         TLSServerNameKey,
+			Label:       "TLS Server Name (SNI)",
+			Placeholder: "Name sent to the server, defaults to its address; jump hosts get their own (TLS transport only)",
+			Value:       data.TLSServerName,
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   InsecureTLSKey,
+			Label: "Skip TLS Certificate Verification (allows interception)",
+			Value: strconv.FormatBool(data.InsecureTLS),
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         LocalDNSKey,
+			Label:       "Local DNS Servers",
+			Placeholder: "Comma-separated, e.g. 1.1.1.1, 9.9.9.9:53 (empty for system)",
+			Value:       data.LocalDNS,
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   PinResolvedIPKey,
+			Label: "Pin Resolved Server IP (resolve again only on connect)",
+			Value: strconv.FormatBool(data.PinResolvedIP),
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   ReverseDNSKey,
+			Label: "Show Reverse DNS Names in the Console (display only)",
+			Value: strconv.FormatBool(data.ReverseDNS),
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   PortCheckKey,
+			Label: "Check Port Before Connecting (TCP/TLS)",
+			Value: strconv.FormatBool(data.PortCheck),
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         DSCPKey,
+			Label:       "DSCP Marking",
+			Placeholder: "DSCP class from 0 to 63, e.g. 46 for expedited forwarding (0 disables)",
+			Required:    true,
+			Value:       strconv.Itoa(data.DSCP),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   UseSystemProxyKey,
+			Label: "Use Proxy From Environment (HTTP_PROXY, NO_PROXY)",
+			Value: strconv.FormatBool(data.UseSystemProxy),
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         JumpHostsKey,
+			Label:       "Jump Hosts",
+			Placeholder: "Comma-separated [user@]host[:port], first hop first",
+			Value:       data.JumpHosts,
+		},
+		{
+			Type:        ui.FieldPassword, // Hide password input
+			Key:         JumpPasswordKey,
+			Label:       "Jump Host Password",
+			Placeholder: "Password for the jump hosts (keys are offered to them too)",
+			Value:       data.JumpPassword,
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   JumpShareAuthKey,
+			Label: "Send Server Password to Jump Hosts (each hop can read it)",
+			Value: strconv.FormatBool(data.JumpShareAuth),
+		},
+		{
+			Type:        ui.FieldTextArea,
+			Key:         SplitTunnelRulesKey,
+			Label:       "Split Tunnel Rules (sing-box)",
+			Placeholder: "Route only these through SSH, one per line: domain:example.com, process:firefox.exe or package:org.mozilla.firefox (empty adds nothing)",
+			Value:       data.SplitTunnelRules,
+			Lines:       3,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         UpstreamOutboundKey,
+			Label:       "Upstream Outbound (sing-box)",
+			Placeholder: "Tag of an existing outbound the split tunnel's SSH outbound dials through, e.g. a VPN (needs split tunnel rules, empty dials directly)",
+			Value:       data.UpstreamOutbound,
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   DiagnosticsKey,
+			Label: "Run Identity Diagnostics After Connecting (the commands below)",
+			Value: strconv.FormatBool(data.Diagnostics),
+		},
+		{
+			Type:        ui.FieldTextArea,
+			Key:         DiagnosticCommandsKey,
+			Label:       "Diagnostic Commands",
+			Placeholder: "One command per line, with the same %-tokens as the command",
+			Value:       data.DiagnosticCommands,
+			Lines:       3,
+		},
+		{
+			Type:        ui.FieldTextArea,
+			Key:         PostConnectStepsKey,
+			Label:       "Post-Connect Steps",
+			Placeholder: "Commands run in order before the command or shell, one per line, with the same %-tokens",
+			Value:       data.PostConnectSteps,
+			Lines:       3,
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   AbortOnStepFailureKey,
+			Label: "Abort On Failed Step (skips the remaining steps and the command or shell)",
+			Value: strconv.FormatBool(data.AbortOnStepFailure),
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         GreetingKey,
+			Label:       "Console Greeting",
+			Placeholder: defaultGreeting,
+			Value:       data.Greeting,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         ConsoleWidthKey,
+			Label:       "Console Line Width",
+			Placeholder: "Longest console line in characters, for narrow screens (0 for no limit)",
+			Required:    true,
+			Value:       strconv.Itoa(data.ConsoleWidth),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   ConsoleWrapKey,
+			Label: "Wrap Long Console Lines (off truncates them)",
+			Value: strconv.FormatBool(data.ConsoleWrap),
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         ServerAliveIntervalKey,
+			Label:       "Server Alive Interval (seconds)",
+			Placeholder: "Seconds between keepalive probes (0 disables)",
+			Required:    true,
+			Value:       strconv.Itoa(data.ServerAliveInterval),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         ServerAliveCountMaxKey,
+			Label:       "Server Alive Count Max",
+			Placeholder: "Unanswered probes before disconnecting",
+			Required:    true,
+			Value:       strconv.Itoa(data.ServerAliveCountMax),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         ConnectAttemptsKey,
+			Label:       "Connection Attempts",
+			Placeholder: "Attempts before giving up on network errors (1 disables retries)",
+			Required:    true,
+			Value:       strconv.Itoa(data.ConnectAttempts),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         ConnectRateKey,
+			Label:       "Connect Rate Limit (per second)",
+			Placeholder: "Connect attempts per second across the extension, against reconnect storms (0 for no limit)",
+			Required:    true,
+			Value:       strconv.Itoa(data.ConnectRate),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         ConnectTimeoutKey,
+			Label:       "Connect Timeout (seconds)",
+			Placeholder: "Time allowed for the first attempt, short for fast failover",
+			Required:    true,
+			Value:       strconv.Itoa(data.ConnectTimeout),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         ConnectTimeoutMaxKey,
+			Label:       "Max Connect Timeout (seconds)",
+			Placeholder: "The timeout doubles on each retry up to this, for slow but working paths",
+			Required:    true,
+			Value:       strconv.Itoa(data.ConnectTimeoutMax),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         HandshakeTimeoutKey,
+			Label:       "Handshake Timeout (seconds)",
+			Placeholder: "Time allowed for the banner, key exchange and login once connected (0 for no limit)",
+			Required:    true,
+			Value:       strconv.Itoa(data.HandshakeTimeout),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   RetryAuthErrorsKey,
+			Label: "Retry Authentication Failures (may lock out the account)",
+			Value: strconv.FormatBool(data.RetryAuthErrors),
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   WaitForConnectKey,
+			Label: "Wait For Connection On Submit (blocks the form)",
+			Value: strconv.FormatBool(data.WaitForConnect),
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         HealthPortKey,
+			Label:       "Health Endpoint Port",
+			Placeholder: "Local port answering /healthz (200 while connected, 503 otherwise) and /ready (0 disables)",
+			Required:    true,
+			Value:       strconv.Itoa(data.HealthPort),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         GlobalRequestKey,
+			Label:       "Global Request (advanced)",
+			Placeholder: "Request name sent after connecting, e.g. example@domain.com",
+			Value:       data.GlobalRequest,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         GlobalRequestPayloadKey,
+			Label:       "Global Request Payload",
+			Placeholder: "Optional payload sent with the global request",
+			Value:       data.GlobalRequestPayload,
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   MTUProbeKey,
+			Label: "Probe MTU After Connecting (needs the echo target below)",
+			Value: strconv.FormatBool(data.MTUProbe),
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         MTUProbeTargetKey,
+			Label:       "MTU Probe Echo Target",
+			Placeholder: "host:port of an echo service reachable from the server",
+			Value:       data.MTUProbeTarget,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         MTUProbeMinKey,
+			Label:       "MTU Probe Min Size (bytes)",
+			Placeholder: "Smallest payload size",
+			Required:    true,
+			Value:       strconv.Itoa(data.MTUProbeMin),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         MTUProbeMaxKey,
+			Label:       "MTU Probe Max Size (bytes)",
+			Placeholder: "Largest payload size",
+			Required:    true,
+			Value:       strconv.Itoa(data.MTUProbeMax),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         LogFilePathKey,
+			Label:       "Log File",
+			Placeholder: "Path to mirror console output to (empty disables)",
+			Value:       data.LogFilePath,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         LogMaxSizeKBKey,
+			Label:       "Log File Max Size (KiB)",
+			Placeholder: "Size at which the log file is rotated",
+			Required:    true,
+			Value:       strconv.Itoa(data.LogMaxSizeKB),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         LogMaxFilesKey,
+			Label:       "Rotated Log Files Kept",
+			Placeholder: "Number of old log files kept",
+			Required:    true,
+			Value:       strconv.Itoa(data.LogMaxFiles),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   HostLogKey,
+			Label: "Mirror Console to App Log (secrets redacted)",
+			Value: strconv.FormatBool(data.HostLog),
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         TraceFilePathKey,
+			Label:       "Connection Trace File (unredacted)",
+			Placeholder: "Path of a JSONL file recording each connection's addresses, bytes and duration (empty disables)",
+			Value:       data.TraceFilePath,
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         TraceMaxSizeKBKey,
+			Label:       "Trace File Max Size (KiB)",
+			Placeholder: "Size at which the trace file is rotated, one old file is kept",
+			Required:    true,
+			Value:       strconv.Itoa(data.TraceMaxSizeKB),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:  ui.FieldSwitch,
+			Key:   RecordTranscriptKey,
+			Label: "Record Session Transcript (may contain sensitive output)",
+			Value: strconv.FormatBool(data.RecordTranscript),
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         TranscriptMaxKBKey,
+			Label:       "Transcript Max Size (KiB)",
+			Placeholder: "Older transcript lines are dropped beyond this size",
+			Required:    true,
+			Value:       strconv.Itoa(data.TranscriptMaxKB),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+	}
+}
+
+// form builds the form for the current settings and state
+func (e *HiddifyExtensionSimpleSsh) form() ui.Form {
+	data := e.data()
+	// Settings fields, with the advanced ones only when expanded
+	fields := e.visibleFields(e.settingsFields())
+
+	// Interactive shell input and output
+	if data.Mode == ModeShell {
+		fields = append(fields, e.shellFields()...)
+	}
+
+	// Console output comes last
+	fields = append(fields, ui.FormField{
+		Type:  ui.FieldConsole,
+		Key:   "console",
+		Label: "Console Output",
+		Value: fitConsole(e.greeting()+e.progressLine()+e.consoleText(), data.ConsoleWidth, data.ConsoleWrap), // Display greeting, connect progress and console output
+		Lines: 20,
+	})
+
+	// UI form creation
+	return ui.Form{
+		Title:       "Simple SSH Command Executor",
+		Description: fmt.Sprintf("Execute a command on a remote SSH server (%s)", e.State()),
+		Buttons:     []string{ui.Button_Cancel, ui.Button_Submit},
+		Fields:      fields,
 	}
 }
 
-// setFormData validates and sets form data
+// setFormData validates the form data into a copy of the settings, which replaces them only
+// when every field is valid, so a rejected submit leaves the settings as they were
 func (e *HiddifyExtensionSimpleSsh) setFormData(data map[string]string) error {
+	previous := e.data()
+	next := previous
+
 	// Validate and store form inputs
 	if val, ok := data[IPKey]; ok {
-		e.Base.Data.IP = val
+		next.IP = val
 	}
 	if val, ok := data[PortKey]; ok {
-		e.Base.Data.Port = val
+		port, err := parsePort(val)
+		if err != nil {
+			return invalidField(PortKey, err)
+		}
+		next.Port = port
+	}
+	if val, ok := data[FallbackPortsKey]; ok {
+		if _, err := parseFallbackPorts(val); err != nil {
+			return invalidField(FallbackPortsKey, err)
+		}
+		next.FallbackPorts = strings.TrimSpace(val)
 	}
 	if val, ok := data[UsernameKey]; ok {
-		e.Base.Data.Username = val
+		next.Username = val
 	}
 	if val, ok := data[PasswordKey]; ok {
-		e.Base.Data.Password = val
+		next.Password = val
+	}
+	if val, ok := data[PrivateKeyKey]; ok {
+		next.PrivateKey = val
+	}
+	if val, ok := data[PassphraseKey]; ok {
+		next.Passphrase = val
+	}
+	if val, ok := data[KeyTypeKey]; ok {
+		if !validKeyType(val) {
+			return invalidField(KeyTypeKey, fmt.Errorf("unknown key type %q", val))
+		}
+		next.KeyType = val
+	}
+	if val, ok := data[UseAgentKey]; ok {
+		next.UseAgent = val == "true"
+	}
+	if val, ok := data[ForwardAgentKey]; ok {
+		next.ForwardAgent = val == "true"
+	}
+	if next.ForwardAgent && !next.UseAgent {
+		return invalidField(ForwardAgentKey, errForwardAgentNeedsAgent)
+	}
+	if val, ok := data[MaxKeysKey]; ok {
+		maxKeys, err := strconv.Atoi(val)
+		if err != nil || maxKeys < 0 {
+			return invalidField(MaxKeysKey, fmt.Errorf("max keys offered must be zero or a positive number"))
+		}
+		next.MaxKeys = maxKeys
 	}
 	if val, ok := data[CommandKey]; ok {
-		e.Base.Data.Command = val
+		if err := validateTokens(val); err != nil {
+			return invalidField(CommandKey, err)
+		}
+		next.Command = val
+	}
+	if val, ok := data[ModeKey]; ok {
+		if val != ModeCommand && val != ModeShell && val != ModeSubsystem {
+			return invalidField(ModeKey, fmt.Errorf("unknown mode %q", val))
+		}
+		next.Mode = val
+	}
+	if val, ok := data[SubsystemKey]; ok {
+		if val == "" {
+			return invalidField(SubsystemKey, fmt.Errorf("subsystem name is required"))
+		}
+		if err := validateSSHName("subsystem", val); err != nil {
+			return invalidField(SubsystemKey, err)
+		}
+		next.Subsystem = val
+	}
+	if val, ok := data[LatencySamplesKey]; ok {
+		samples, err := strconv.Atoi(val)
+		if err != nil || samples < 1 {
+			return invalidField(LatencySamplesKey, fmt.Errorf("latency samples must be a positive number"))
+		}
+		next.LatencySamples = samples
+	}
+	if val, ok := data[SpeedTestMBKey]; ok {
+		size, err := strconv.Atoi(val)
+		if err != nil || size < 1 || size > maxSpeedTestMB {
+			return invalidField(SpeedTestMBKey, fmt.Errorf("speed test size must be between 1 and %d MiB", maxSpeedTestMB))
+		}
+		next.SpeedTestMB = size
+	}
+	if val, ok := data[AlgorithmPresetKey]; ok {
+		if _, ok := algorithmPresets[val]; !ok {
+			return invalidField(AlgorithmPresetKey, fmt.Errorf("unknown algorithm preset %q", val))
+		}
+		next.AlgorithmPreset = val
+	}
+	if val, ok := data[CiphersKey]; ok {
+		if _, err := parseAlgorithmList(val, supportedCiphers, "cipher"); err != nil {
+			return invalidField(CiphersKey, err)
+		}
+		next.Ciphers = val
+	}
+	if val, ok := data[KeyExchangesKey]; ok {
+		if _, err := parseAlgorithmList(val, supportedKeyExchanges, "key exchange"); err != nil {
+			return invalidField(KeyExchangesKey, err)
+		}
+		next.KeyExchanges = val
+	}
+	if val, ok := data[MACsKey]; ok {
+		if _, err := parseAlgorithmList(val, supportedMACs, "MAC"); err != nil {
+			return invalidField(MACsKey, err)
+		}
+		next.MACs = val
+	}
+	if val, ok := data[HostKeyAlgorithmsKey]; ok {
+		if _, err := parseAlgorithmList(val, supportedHostKeyAlgorithms, "host key"); err != nil {
+			return invalidField(HostKeyAlgorithmsKey, err)
+		}
+		next.HostKeyAlgorithms = val
+	}
+	if val, ok := data[HostKeysKey]; ok {
+		if _, err := parsePinnedHostKeys(val); err != nil {
+			return invalidField(HostKeysKey, err)
+		}
+		next.HostKeys = val
+	}
+	if val, ok := data[TrustPolicyKey]; ok {
+		if !validTrustPolicy(val) {
+			return invalidField(TrustPolicyKey, fmt.Errorf("unknown trust policy %q", val))
+		}
+		next.TrustPolicy = val
+	}
+	if val, ok := data[RekeyThresholdKey]; ok {
+		threshold, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || (threshold != 0 && threshold < minRekeyThreshold) {
+			return invalidField(RekeyThresholdKey, fmt.Errorf("rekey threshold must be 0 or at least %d bytes", minRekeyThreshold))
+		}
+		next.RekeyThreshold = threshold
+	}
+	if val, ok := data[KnownHostsFileKey]; ok {
+		next.KnownHostsFile = val
+	}
+	if val, ok := data[KnownHostsMatchKey]; ok {
+		if !validKnownHostsMatch(val) {
+			return invalidField(KnownHostsMatchKey, fmt.Errorf("unknown known_hosts matching %q", val))
+		}
+		next.KnownHostsMatch = val
+	}
+	if val, ok := data[FingerprintFormatKey]; ok {
+		if !validFingerprintFormat(val) {
+			return invalidField(FingerprintFormatKey, fmt.Errorf("unknown fingerprint format %q", val))
+		}
+		next.FingerprintFormat = val
+	}
+	if val, ok := data[TransportKey]; ok {
+		next.Transport = val
+	}
+	if val, ok := data[WebSocketURLKey]; ok {
+		next.WebSocketURL = strings.TrimSpace(val)
+	}
+	if val, ok := data[TLSServerNameKey]; ok {
+		next.TLSServerName = strings.TrimSpace(val)
+	}
+	if val, ok := data[InsecureTLSKey]; ok {
+		next.InsecureTLS = val == "true"
+	}
+	if val, ok := data[LocalDNSKey]; ok {
+		if _, err := parseDNSServers(val); err != nil {
+			return invalidField(LocalDNSKey, err)
+		}
+		next.LocalDNS = strings.TrimSpace(val)
+	}
+	if val, ok := data[ReverseDNSKey]; ok {
+		next.ReverseDNS = val == "true"
+	}
+	if val, ok := data[PinResolvedIPKey]; ok {
+		next.PinResolvedIP = val == "true"
+	}
+	if val, ok := data[PortCheckKey]; ok {
+		next.PortCheck = val == "true"
+	}
+	if val, ok := data[DSCPKey]; ok {
+		dscp, err := strconv.Atoi(val)
+		if err != nil || dscp < 0 || dscp > maxDSCP {
+			return invalidField(DSCPKey, fmt.Errorf("DSCP must be a number from 0 to %d", maxDSCP))
+		}
+		next.DSCP = dscp
+	}
+	if val, ok := data[UseSystemProxyKey]; ok {
+		next.UseSystemProxy = val == "true"
+	}
+	if val, ok := data[SplitTunnelRulesKey]; ok {
+		if _, err := parseSplitTunnelRules(val); err != nil {
+			return invalidField(SplitTunnelRulesKey, err)
+		}
+		next.SplitTunnelRules = strings.TrimSpace(val)
+	}
+	if val, ok := data[UpstreamOutboundKey]; ok {
+		tag := strings.TrimSpace(val)
+		if tag == outboundTag {
+			return invalidField(UpstreamOutboundKey, fmt.Errorf("the SSH outbound %q cannot dial through itself", outboundTag))
+		}
+		next.UpstreamOutbound = tag
+	}
+	if val, ok := data[JumpHostsKey]; ok {
+		if _, err := parseJumpHosts(val); err != nil {
+			return invalidField(JumpHostsKey, err)
+		}
+		next.JumpHosts = strings.TrimSpace(val)
+	}
+	if val, ok := data[JumpPasswordKey]; ok {
+		next.JumpPassword = val
+	}
+	if val, ok := data[JumpShareAuthKey]; ok {
+		next.JumpShareAuth = val == "true"
+	}
+	if val, ok := data[DiagnosticsKey]; ok {
+		next.Diagnostics = val == "true"
+	}
+	if val, ok := data[DiagnosticCommandsKey]; ok {
+		if err := validateTokens(val); err != nil {
+			return invalidField(DiagnosticCommandsKey, err)
+		}
+		next.DiagnosticCommands = val
+	}
+	if val, ok := data[PostConnectStepsKey]; ok {
+		if err := validateTokens(val); err != nil {
+			return invalidField(PostConnectStepsKey, err)
+		}
+		next.PostConnectSteps = val
+	}
+	if val, ok := data[AbortOnStepFailureKey]; ok {
+		next.AbortOnStepFailure = val == "true"
+	}
+	if val, ok := data[GreetingKey]; ok {
+		next.Greeting = strings.TrimSpace(val)
+	}
+	if val, ok := data[ConsoleWidthKey]; ok {
+		width, err := strconv.Atoi(val)
+		if err != nil || width < 0 || (width > 0 && width < minConsoleWidth) {
+			return invalidField(ConsoleWidthKey, fmt.Errorf("console line width must be 0 or at least %d", minConsoleWidth))
+		}
+		next.ConsoleWidth = width
+	}
+	if val, ok := data[ConsoleWrapKey]; ok {
+		next.ConsoleWrap = val == "true"
+	}
+	if val, ok := data[ServerAliveIntervalKey]; ok {
+		interval, err := strconv.Atoi(val)
+		if err != nil || interval < 0 {
+			return invalidField(ServerAliveIntervalKey, fmt.Errorf("server alive interval must be zero or a positive number of seconds"))
+		}
+		next.ServerAliveInterval = interval
+	}
+	if val, ok := data[ServerAliveCountMaxKey]; ok {
+		countMax, err := strconv.Atoi(val)
+		if err != nil || countMax < 1 {
+			return invalidField(ServerAliveCountMaxKey, fmt.Errorf("server alive count max must be a positive number"))
+		}
+		next.ServerAliveCountMax = countMax
+	}
+	if val, ok := data[ConnectAttemptsKey]; ok {
+		attempts, err := strconv.Atoi(val)
+		if err != nil || attempts < 1 {
+			return invalidField(ConnectAttemptsKey, fmt.Errorf("connection attempts must be a positive number"))
+		}
+		next.ConnectAttempts = attempts
+	}
+	if val, ok := data[ConnectRateKey]; ok {
+		rate, err := strconv.Atoi(val)
+		if err != nil || rate < 0 {
+			return invalidField(ConnectRateKey, fmt.Errorf("connect rate limit must be zero or a positive number"))
+		}
+		next.ConnectRate = rate
+	}
+	if val, ok := data[ConnectTimeoutKey]; ok {
+		timeout, err := strconv.Atoi(val)
+		if err != nil || timeout < 1 {
+			return invalidField(ConnectTimeoutKey, fmt.Errorf("connect timeout must be a positive number of seconds"))
+		}
+		next.ConnectTimeout = timeout
+	}
+	if val, ok := data[ConnectTimeoutMaxKey]; ok {
+		timeout, err := strconv.Atoi(val)
+		if err != nil || timeout < 1 {
+			return invalidField(ConnectTimeoutMaxKey, fmt.Errorf("max connect timeout must be a positive number of seconds"))
+		}
+		next.ConnectTimeoutMax = timeout
+	}
+	if val, ok := data[HandshakeTimeoutKey]; ok {
+		timeout, err := strconv.Atoi(val)
+		if err != nil || timeout < 0 {
+			return invalidField(HandshakeTimeoutKey, fmt.Errorf("handshake timeout must be zero or a positive number of seconds"))
+		}
+		next.HandshakeTimeout = timeout
+	}
+	if next.ConnectTimeoutMax < next.ConnectTimeout {
+		return invalidField(ConnectTimeoutMaxKey, fmt.Errorf("max connect timeout must not be below the connect timeout of %d seconds", next.ConnectTimeout))
+	}
+	if val, ok := data[RetryAuthErrorsKey]; ok {
+		next.RetryAuthErrors = val == "true"
+	}
+	if val, ok := data[WaitForConnectKey]; ok {
+		next.WaitForConnect = val == "true"
+	}
+	if val, ok := data[HealthPortKey]; ok {
+		port, err := strconv.Atoi(val)
+		if err != nil || port < 0 || port > 65535 {
+			return invalidField(HealthPortKey, fmt.Errorf("health endpoint port must be between 0 and 65535"))
+		}
+		next.HealthPort = port
+	}
+	if val, ok := data[GlobalRequestKey]; ok {
+		name := strings.TrimSpace(val)
+		if err := validateRequestName(name); err != nil {
+			return invalidField(GlobalRequestKey, err)
+		}
+		next.GlobalRequest = name
+	}
+	if val, ok := data[GlobalRequestPayloadKey]; ok {
+		next.GlobalRequestPayload = val
+	}
+	if val, ok := data[MTUProbeKey]; ok {
+		next.MTUProbe = val == "true"
+	}
+	if val, ok := data[MTUProbeTargetKey]; ok {
+		next.MTUProbeTarget = strings.TrimSpace(val)
+	}
+	if val, ok := data[MTUProbeMinKey]; ok {
+		size, err := strconv.Atoi(val)
+		if err != nil {
+			return invalidField(MTUProbeMinKey, fmt.Errorf("MTU probe min size must be a number"))
+		}
+		next.MTUProbeMin = size
+	}
+	if val, ok := data[MTUProbeMaxKey]; ok {
+		size, err := strconv.Atoi(val)
+		if err != nil {
+			return invalidField(MTUProbeMaxKey, fmt.Errorf("MTU probe max size must be a number"))
+		}
+		next.MTUProbeMax = size
+	}
+	if val, ok := data[ShellColumnsKey]; ok {
+		columns, err := strconv.Atoi(val)
+		if err != nil || columns < 1 {
+			return invalidField(ShellColumnsKey, fmt.Errorf("shell columns must be a positive number"))
+		}
+		next.ShellColumns = columns
+	}
+	if val, ok := data[ShellRowsKey]; ok {
+		rows, err := strconv.Atoi(val)
+		if err != nil || rows < 1 {
+			return invalidField(ShellRowsKey, fmt.Errorf("shell rows must be a positive number"))
+		}
+		next.ShellRows = rows
+	}
+	if val, ok := data[LogFilePathKey]; ok {
+		next.LogFilePath = strings.TrimSpace(val)
+	}
+	if val, ok := data[LogMaxSizeKBKey]; ok {
+		size, err := strconv.Atoi(val)
+		if err != nil || size < 1 {
+			return invalidField(LogMaxSizeKBKey, fmt.Errorf("log file max size must be a positive number"))
+		}
+		next.LogMaxSizeKB = size
+	}
+	if val, ok := data[LogMaxFilesKey]; ok {
+		files, err := strconv.Atoi(val)
+		if err != nil || files < 0 {
+			return invalidField(LogMaxFilesKey, fmt.Errorf("rotated log files kept must be zero or a positive number"))
+		}
+		next.LogMaxFiles = files
+	}
+	if val, ok := data[HostLogKey]; ok {
+		next.HostLog = val == "true"
+	}
+	if val, ok := data[TraceFilePathKey]; ok {
+		next.TraceFilePath = strings.TrimSpace(val)
+	}
+	if val, ok := data[TraceMaxSizeKBKey]; ok {
+		size, err := strconv.Atoi(val)
+		if err != nil || size < 1 {
+			return invalidField(TraceMaxSizeKBKey, fmt.Errorf("trace file max size must be a positive number"))
+		}
+		next.TraceMaxSizeKB = size
+	}
+	if val, ok := data[RecordTranscriptKey]; ok {
+		next.RecordTranscript = val == "true"
+	}
+	if val, ok := data[TranscriptMaxKBKey]; ok {
+		size, err := strconv.Atoi(val)
+		if err != nil || size < 1 {
+			return invalidField(TranscriptMaxKBKey, fmt.Errorf("transcript max size must be a positive number"))
+		}
+		next.TranscriptMaxKB = size
+	}
+	if err := validateMTUProbe(next); err != nil {
+		return err
+	}
+	if err := validateTransport(next); err != nil {
+		return err
+	}
+	if err := validateUpstream(next); err != nil {
+		return err
+	}
+
+	e.dataMu.Lock()
+	if _, ok := data[HostKeysKey]; !ok {
+		next.HostKeys = e.Base.Data.HostKeys // Keep keys pinned by a connection meanwhile
+	}
+	e.Base.Data = next
+	e.dataMu.Unlock()
+	if next.Port != previous.Port || next.FallbackPorts != previous.FallbackPorts {
+		e.workingPort.Store("") // Start over from the configured port
 	}
 	return nil
 }
 
-// backgroundTask connects to the SSH server and executes the command
-func (e *HiddifyExtensionSimpleSsh) backgroundTask(ctx context.Context) {
+// connect dials the SSH server with the current settings, reporting progress and failures to the console
+func (e *HiddifyExtensionSimpleSsh) connect(ctx context.Context) (*ssh.Client, error) {
+	return e.connectWith(ctx, e.authMethods)
+}
+
+// connectWith establishes the SSH connection using the authentication methods from prepare
+func (e *HiddifyExtensionSimpleSsh) connectWith(ctx context.Context, prepare func() ([]ssh.AuthMethod, func(), error)) (*ssh.Client, error) {
+	data := e.data()
+	// Describe the connection in OpenSSH terms
+	e.addAndUpdateConsole(yellow.Sprint("Equivalent command: "), e.equivalentCommand())
+
+	if data.TraceFilePath != "" {
+		e.addAndUpdateConsole(yellow.Sprint("Tracing connections to: "), data.TraceFilePath+" (addresses are recorded unredacted)")
+	}
+
+	// Prepare authentication methods
+	auth, cleanup, err := prepare()
+	if err != nil {
+		e.addAndUpdateConsole(red.Sprint("Failed to prepare authentication: "), err.Error())
+		return nil, err
+	}
+	defer cleanup()
+
+	// Restrict the offered algorithms to the preset and explicit lists
+	algorithms, err := resolveAlgorithms(e.data())
+	if err != nil {
+		e.addAndUpdateConsole(red.Sprint("Invalid algorithms: "), err.Error())
+		return nil, err
+	}
+	if algorithms.ciphers != nil || algorithms.keyExchanges != nil || algorithms.macs != nil || algorithms.hostKeys != nil {
+		e.addAndUpdateConsole(yellow.Sprint("Algorithms ("+data.AlgorithmPreset+"): "), algorithms.describe())
+	}
+
 	// Prepare SSH connection configuration
+	var addresses []string
+	for _, port := range e.candidatePorts() {
+		addresses = append(addresses, fmt.Sprintf("%s:%s", data.IP, port))
+	}
+	hostKeyCallback, err := e.hostKeyCallback()
+	if err != nil {
+		e.addAndUpdateConsole(red.Sprint("Host key verification: "), err.Error())
+		return nil, err
+	}
 	config := &ssh.ClientConfig{
-		User: e.Base.Data.Username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(e.Base.Data.Password),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // Skip host key verification (for simplicity)
-		Timeout:         5 * time.Second,
+		User:              data.Username,
+		Auth:              auth,
+		HostKeyCallback:   e.authProgress(permanentHostKeyErrors(e.rememberHostKey(addresses, hostKeyCallback))),
+		HostKeyAlgorithms: algorithms.hostKeys,
 	}
+	config.Ciphers, config.KeyExchanges, config.MACs = algorithms.ciphers, algorithms.keyExchanges, algorithms.macs
+	if data.RekeyThreshold > 0 {
+		config.RekeyThreshold = uint64(data.RekeyThreshold)
+		e.addAndUpdateConsole(yellow.Sprint("Rekey threshold: "), strconv.FormatInt(data.RekeyThreshold, 10)+" bytes")
+	}
+
+	// Connect to the SSH server, retrying transient failures
+	client, address, err := e.dialWithRetries(e.withResolver(ctx), addresses, config)
+	if err != nil {
+		return nil, err
+	}
+	e.addAndUpdateConsole(green.Sprint("Connected: "), e.displayAddress(address, client.RemoteAddr()))
+	return client, nil
+}
+
+// backgroundTask connects to the SSH server and executes the command
+func (e *HiddifyExtensionSimpleSsh) backgroundTask(ctx context.Context, task uint64, ready chan<- error) {
+	data := e.data()
+	defer func() {
+		e.lifecycle.finished(task)
+		e.UpdateUI(e.form()) // Show the final state
+	}()
 
 	// Connect to the SSH server
-	address := fmt.Sprintf("%s:%s", e.Base.Data.IP, e.Base.Data.Port)
-	client, err := ssh.Dial("tcp", address, config)
+	client, err := e.connect(ctx)
+	notifyReady(ready, err)
 	if err != nil {
-		e.addAndUpdateConsole(red.Sprint("Failed to connect: "), err.Error())
+		if ctx.Err() == nil {
+			e.connectFailed(task, err)
+		}
 		return
 	}
 	defer client.Close()
+	e.lifecycle.connected(task)
+
+	// Closing the client aborts whatever is running when the task is cancelled
+	stopClose := context.AfterFunc(ctx, func() { client.Close() })
+	defer stopClose()
+
+	// Explain why the server closes the connection, if it says
+	go e.watchDisconnect(client)
+
+	// Drop the connection if the server stops answering
+	keepAliveCtx, stopKeepAlive := context.WithCancel(ctx)
+	defer stopKeepAlive()
+	go e.keepAlive(keepAliveCtx, client)
+
+	// Send the custom global request, if any
+	if data.GlobalRequest != "" {
+		e.sendGlobalRequest(client)
+	}
+
+	// Optionally confirm which host we landed on
+	if data.Diagnostics {
+		e.runDiagnostics(ctx, client)
+	}
+
+	// Optionally look for MTU blackholes through the tunnel
+	if data.MTUProbe {
+		e.probeMTU(ctx, client)
+	}
+
+	// Run the setup sequence before the command
+	if !e.runPostConnect(ctx, client) {
+		return
+	}
 
 	// Create a session
 	session, err := client.NewSession()
@@ -153,73 +1486,295 @@ func (e *HiddifyExtensionSimpleSsh) backgroundTask(ctx context.Context) {
 	}
 	defer session.Close()
 
+	// Subsystem mode only checks the server accepts the subsystem
+	if data.Mode == ModeSubsystem {
+		e.requestSubsystem(session)
+		return
+	}
+
+	// Optionally let the command use the local agent
+	if data.ForwardAgent {
+		stopForwarding, err := e.forwardAgent(client, session)
+		if err != nil {
+			e.addAndUpdateConsole(red.Sprint("Failed to forward SSH agent: "), err.Error())
+			return
+		}
+		defer stopForwarding()
+	}
+
 	// Execute the command and get output
-	output, err := session.CombinedOutput(e.Base.Data.Command)
+	var output bytes.Buffer
+	session.Stdout = transcriptWriter{e, &output, "stdout"}
+	session.Stderr = transcriptWriter{e, &output, "stderr"}
+	command, err := expandTokens(data.Command, e.commandTokens())
 	if err != nil {
-		e.addAndUpdateConsole(red.Sprint("Command execution failed: "), err.Error())
+		e.addAndUpdateConsole(red.Sprint("Invalid command: "), err.Error())
+		return
+	}
+	e.startTranscript("exec: " + command)
+	err = session.Run(command)
+	if err != nil {
+		e.addAndUpdateConsole(red.Sprint("Command execution failed: "), sanitizeText(err.Error()))
 		return
 	}
 
 	// Print the output
-	e.addAndUpdateConsole(green.Sprint("Command executed successfully:\n"), string(output))
+	e.addAndUpdateConsole(green.Sprint("Command executed successfully:\n"), sanitizeText(output.String()))
+}
+
+// greeting returns the welcome message shown at the top of the console
+func (e *HiddifyExtensionSimpleSsh) greeting() string {
+	data := e.data()
+	if data.Greeting == "" {
+		return yellow.Sprintln(defaultGreeting)
+	}
+	return yellow.Sprintln(data.Greeting)
+}
+
+// recordLatency stores a latency sample and prints the recent latency graph
+func (e *HiddifyExtensionSimpleSsh) recordLatency(latency time.Duration) {
+	samples := e.data().LatencySamples
+	if samples <= 0 {
+		samples = defaultLatencySamples
+	}
+	e.latencies.resize(samples)
+	e.latencies.add(latency)
+	e.addAndUpdateConsole(yellow.Sprintf("Latency: %v", latency.Round(time.Millisecond)), e.latencies.sparkline())
 }
 
 // addAndUpdateConsole adds messages to the console and updates the UI
 func (e *HiddifyExtensionSimpleSsh) addAndUpdateConsole(message ...any) {
-	e.console = fmt.Sprintln(message...) + e.console
-	e.UpdateUI(e.GetUI()) // Refresh the UI with new console content
+	line := fmt.Sprintln(message...)
+	e.logToHost(line)
+	e.consoleMu.Lock()
+	e.console = e.logToFile(line) + line + e.console
+	e.consoleMu.Unlock()
+	e.UpdateUI(e.form()) // Refresh the UI with new console content
+}
+
+// consoleText returns the console output, newest line first
+func (e *HiddifyExtensionSimpleSsh) consoleText() string {
+	e.consoleMu.Lock()
+	defer e.consoleMu.Unlock()
+	return e.console
 }
 
 // SubmitData processes form submission and starts the background task
 func (e *HiddifyExtensionSimpleSsh) SubmitData(data map[string]string) error {
+	e.formActive.Store(true) // Submitted from the form, so it is shown
 	// Validate and set the form data
 	err := e.setFormData(data)
 	if err != nil {
-		e.ShowMessage("Invalid data", err.Error())
+		// Name the offending field when known
+		title := "Invalid data"
+		var invalid *ValidationError
+		if errors.As(err, &invalid) {
+			title = "Invalid " + e.fieldLabel(invalid.Field)
+		}
+		e.ShowMessage(title, err.Error())
 		return err
 	}
 
-	// Cancel any ongoing background task
-	if e.cancel != nil {
-		e.cancel()
+	settings := e.data() // The submitted settings, read once for the checks below
+
+	// The health endpoint follows the submitted port
+	e.syncHealthServer()
+
+	// Actions that do not connect
+	switch data[ActionKey] {
+	case ActionOutboundJSON:
+		e.showOutboundJSON()
+		return nil
+	case ActionTranscript:
+		e.showTranscript()
+		return nil
+	case ActionGenerateKey:
+		e.generateKeyPair()
+		return nil
+	case ActionSelfCheck:
+		e.selfCheck()
+		return nil
+	case ActionHostKey:
+		e.showHostKey()
+		return nil
+	case ActionExportKeys:
+		e.showHostKeyExport()
+		return nil
+	case ActionImportKeys:
+		e.importHostKeys(data[HostKeysImportKey])
+		return nil
+	case ActionTrustHostKey:
+		e.trustPresentedKey()
+		return nil
+	case ActionAdvanced:
+		e.showAdvanced.Store(!e.showAdvanced.Load())
+		e.UpdateUI(e.form())
+		return nil
+	}
+
+	// Fail early instead of with "all auth methods failed" deep in the handshake; installing a key checks the password itself
+	if data[ActionKey] != ActionInstallKey {
+		if err := requireAuthMethod(settings); err != nil {
+			e.ShowMessage("No authentication method", err.Error())
+			return err
+		}
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	e.cancel = cancel
 
-	// Start SSH command execution in the background
-	go e.backgroundTask(ctx)
+	// The speed test uses its own connection and leaves the running one alone
+	if data[ActionKey] == ActionSpeedTest {
+		if !e.speedTesting.CompareAndSwap(false, true) {
+			e.addAndUpdateConsole(yellow.Sprint("Speed test: "), "already running")
+			return nil
+		}
+		go e.speedTestTask()
+		return nil
+	}
 
-	return nil
+	// Optionally report the connection outcome to the caller instead of only to the console
+	var ready chan error
+	if settings.WaitForConnect && data[ActionKey] != ActionInstallKey {
+		ready = make(chan error, 1)
+	}
+
+	// Input for an open interactive shell needs no new connection
+	if settings.Mode == ModeShell && data[ActionKey] != ActionInstallKey && e.sendShellInput(data[ShellInputKey]) {
+		return nil
+	}
+
+	// Replace any ongoing background task, unless it already runs the submitted settings
+	var submitted *connectionSettings
+	if data[ActionKey] != ActionInstallKey {
+		current := connectionSettingsOf(settings)
+		submitted = &current
+	}
+	previous := e.lifecycle.running()
+	ctx, task, err := e.lifecycle.start(submitted)
+	if errors.Is(err, errAlreadyRunning) {
+		e.addAndUpdateConsole(yellow.Sprintf("Already %s: ", e.State()), "settings are unchanged, keeping the running connection")
+		if settings.Mode == ModeShell && data[ShellInputKey] != "" {
+			e.addAndUpdateConsole(yellow.Sprint("Shell is still connecting, input ignored"))
+		}
+		return nil
+	}
+	if err != nil {
+		e.ShowMessage("Busy", err.Error())
+		return err
+	}
+	e.clearPinnedIP() // An explicit connect resolves the server again
+	if previous != nil && submitted != nil {
+		var labels []string
+		for _, key := range changedSettings(*previous, *submitted) {
+			labels = append(labels, e.fieldLabel(key))
+		}
+		e.addAndUpdateConsole(yellow.Sprint("Reconnecting: "), strings.Join(labels, ", ")+" changed")
+	}
+
+	// Start the key installation or SSH command execution in the background
+	if data[ActionKey] == ActionInstallKey {
+		go e.installKeyTask(ctx, task)
+		return nil
+	}
+	if settings.Mode == ModeShell {
+		go e.shellTask(ctx, task, data[ShellInputKey], ready)
+		return waitReady(ready, e.readyTimeout())
+	}
+	go e.backgroundTask(ctx, task, ready)
+	return waitReady(ready, e.readyTimeout())
+}
+
+// connectFailed leaves the connection in the failed state once every attempt has failed and
+// tells the user, who reconnects by submitting again
+func (e *HiddifyExtensionSimpleSsh) connectFailed(task uint64, err error) {
+	e.lifecycle.failed(task)
+	kind, _ := classifyConnectError(err)
+	e.addAndUpdateConsole(red.Sprint("Connection failed: "), kind+" failure, giving up: "+sanitizeText(err.Error()))
+	if e.formActive.Load() { // Nobody reads the dialog while the form is closed, the console keeps the reason
+		e.ShowMessage("Connection failed", sanitizeText(err.Error())+"\n\nChoose \"Reconnect\" and submit to try again.")
+	}
+}
+
+// connectLabel names the connect action, offering a reconnect after a failure
+func (e *HiddifyExtensionSimpleSsh) connectLabel() string {
+	if e.State() == StateFailed {
+		return "Reconnect"
+	}
+	return "Connect"
 }
 
 // Cancel stops the background task
 func (e *HiddifyExtensionSimpleSsh) Cancel() error {
-	if e.cancel != nil {
-		e.cancel()     // Cancel background task
-		e.cancel = nil // Clear cancel function
-	}
+	e.lifecycle.stop() // Cancel background task, including an interactive shell
 	return nil
 }
 
 // Stop is called when the extension is closed
 func (e *HiddifyExtensionSimpleSsh) Stop() error {
-	return e.Cancel()
+	err := e.Cancel()
+	e.formActive.Store(false)
+	e.logFile.close()
+	e.traceFile.close()
+	e.stopHealthServer()
+	return err
 }
 
 // NewHiddifyExtensionSimpleSsh initializes a new instance of HiddifyExtensionSimpleSsh
 func NewHiddifyExtensionSimpleSsh() ex.Extension {
-	return &HiddifyExtensionSimpleSsh{
+	e := &HiddifyExtensionSimpleSsh{
 		Base: ex.Base[HiddifyExtensionSimpleSshData]{ // Set default values
 			Data: HiddifyExtensionSimpleSshData{
-				IP:       "127.0.0.1",
-				Port:     "22",
-				Username: "",
-				Password: "",
-				Command:  "echo 'Hello, World!'",
+				IP:         "127.0.0.1",
+				Port:       "22",
+				Username:   "",
+				Password:   "",
+				PrivateKey: "",
+				Passphrase: "",
+				KeyType:    KeyTypeED25519,
+				MaxKeys:    defaultMaxKeys,
+				Command:    "echo 'Hello, World!'",
+				Mode:       ModeCommand,
+				Subsystem:  defaultSubsystem,
+
+				ConsoleWrap:       true,
+				LatencySamples:    defaultLatencySamples,
+				SpeedTestMB:       defaultSpeedTestMB,
+				AlgorithmPreset:   PresetDefault,
+				TrustPolicy:       TrustPolicyAsk,
+				KnownHostsMatch:   KnownHostsMatchHostname,
+				FingerprintFormat: FingerprintSHA256,
+				Transport:         TransportTCP,
+				UseSystemProxy:    true,
+
+				DiagnosticCommands: defaultDiagnosticCommands,
+
+				ServerAliveInterval: defaultServerAliveInterval,
+				ServerAliveCountMax: defaultServerAliveCountMax,
+
+				ConnectAttempts:   defaultConnectAttempts,
+				ConnectRate:       defaultConnectRate,
+				ConnectTimeout:    defaultConnectTimeout,
+				ConnectTimeoutMax: defaultConnectTimeoutMax,
+				HandshakeTimeout:  defaultHandshakeTimeout,
+
+				MTUProbeMin: defaultMTUProbeMin,
+				MTUProbeMax: defaultMTUProbeMax,
+
+				ShellColumns: defaultShellColumns,
+				ShellRows:    defaultShellRows,
+
+				LogMaxSizeKB: defaultLogMaxSizeKB,
+				LogMaxFiles:  defaultLogMaxFiles,
+
+				TraceMaxSizeKB: defaultTraceMaxSizeKB,
+
+				TranscriptMaxKB: defaultTranscriptMaxKB,
 			},
 		},
-		console: yellow.Sprint("Ready to execute commands over SSH\n"),
+		latencies: newLatencyHistory(defaultLatencySamples),
 	}
+
+	// Provisioned settings replace the defaults
+	e.applyBootstrapConfig()
+	return e
 }
 
 // init registers the extension with metadata
@@ -0,0 +1,40 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hiddify/hiddify-core/extension/ui"
+)
+
+func TestUpdateUIWhileFormShown(t *testing.T) {
+	e := NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh)
+	var sent []ui.Form
+	e.toHost = func(form ui.Form) error {
+		sent = append(sent, form)
+		return nil
+	}
+
+	// Until the host opens the form, the console only buffers
+	e.addAndUpdateConsole("before the form is shown")
+	if len(sent) != 0 {
+		t.Fatalf("%d updates sent before the form was shown, want none", len(sent))
+	}
+
+	e.GetUI()
+	e.addAndUpdateConsole("while the form is shown")
+	if len(sent) != 1 {
+		t.Fatalf("%d updates sent while the form is shown, want 1", len(sent))
+	}
+	if form := fmt.Sprint(sent[0]); !strings.Contains(form, "while the form is shown") || !strings.Contains(form, "before the form is shown") {
+		t.Errorf("update lacks the buffered and new console lines: %s", form)
+	}
+
+	// Closing the extension stops the updates again
+	e.Stop()
+	e.addAndUpdateConsole("after the form is closed")
+	if len(sent) != 1 {
+		t.Errorf("%d updates sent after Stop, want none after the first", len(sent))
+	}
+}
@@ -0,0 +1,170 @@
+package hiddify_extension
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Host key fingerprint formats
+const (
+	FingerprintSHA256 = "sha256"
+	FingerprintMD5    = "md5"
+	FingerprintBoth   = "both"
+)
+
+// Randomart field size and symbols, as drawn by ssh-keygen -lv
+const (
+	randomartWidth   = 17
+	randomartHeight  = 9
+	randomartSymbols = " .o+=*BOX@%&#/^SE"
+)
+
+// validFingerprintFormat reports whether format is a known fingerprint format
+func validFingerprintFormat(format string) bool {
+	switch format {
+	case FingerprintSHA256, FingerprintMD5, FingerprintBoth:
+		return true
+	}
+	return false
+}
+
+// presentedHostKey is the host key the server presented on the last connection
+type presentedHostKey struct {
+	mu      sync.Mutex
+	key     ssh.PublicKey
+	address string
+}
+
+// fingerprint formats a host key in the preferred fingerprint format
+func (e *HiddifyExtensionSimpleSsh) fingerprint(key ssh.PublicKey) string {
+	switch e.data().FingerprintFormat {
+	case FingerprintMD5:
+		return key.Type() + " MD5:" + ssh.FingerprintLegacyMD5(key)
+	case FingerprintBoth:
+		return key.Type() + " " + ssh.FingerprintSHA256(key) + " MD5:" + ssh.FingerprintLegacyMD5(key)
+	default:
+		return key.Type() + " " + ssh.FingerprintSHA256(key)
+	}
+}
+
+// rememberHostKey wraps a host key callback to log and remember the key presented by the server
+// at any of addresses or by a jump host, so a rejected key can be shown and trusted
+func (e *HiddifyExtensionSimpleSsh) rememberHostKey(addresses []string, callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		e.presentedKey.mu.Lock()
+		e.presentedKey.key, e.presentedKey.address = key, hostname
+		e.presentedKey.mu.Unlock()
+		if slices.Contains(addresses, hostname) {
+			e.addAndUpdateConsole(yellow.Sprint("Server host key: "), e.fingerprint(key))
+		} else {
+			e.addAndUpdateConsole(yellow.Sprint("Jump host key: "), hostname+" "+e.fingerprint(key))
+		}
+		return callback(hostname, remote, key)
+	}
+}
+
+// showHostKey displays the last presented host key with its fingerprints and randomart, so it can
+// be compared out of band and copied into the pinned host keys
+func (e *HiddifyExtensionSimpleSsh) showHostKey() {
+	e.presentedKey.mu.Lock()
+	key, address := e.presentedKey.key, e.presentedKey.address
+	e.presentedKey.mu.Unlock()
+
+	if key == nil {
+		e.ShowMessage("Server Host Key", "No host key has been seen yet. Connect first, then show the key again.")
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Host: %s\nType: %s\n\n", address, key.Type())
+	fmt.Fprintf(&sb, "%s\nMD5:%s\n\n", ssh.FingerprintSHA256(key), ssh.FingerprintLegacyMD5(key))
+	fmt.Fprintf(&sb, "%s\n\n", randomart(key))
+	pin := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	if hops, _ := jumpHostAddresses(e.data().JumpHosts); slices.Contains(hops, address) {
+		pin += " " + address // Applies the pin to this jump host only
+	}
+	fmt.Fprintf(&sb, "To pin this key, paste the line below into \"Pinned Host Keys\":\n%s", pin)
+	e.ShowMessage("Server Host Key", sb.String())
+}
+
+// randomart draws the key's SHA256 fingerprint as the "drunken bishop" picture of ssh-keygen -lv
+func randomart(key ssh.PublicKey) string {
+	digest := sha256.Sum256(key.Marshal())
+	last := len(randomartSymbols) - 1 // Index of the end marker
+
+	var field [randomartWidth][randomartHeight]int
+	x, y := randomartWidth/2, randomartHeight/2
+	for _, input := range digest {
+		for step := 0; step < 4; step++ {
+			if input&1 != 0 {
+				x++
+			} else {
+				x--
+			}
+			if input&2 != 0 {
+				y++
+			} else {
+				y--
+			}
+			x, y = min(max(x, 0), randomartWidth-1), min(max(y, 0), randomartHeight-1)
+			if field[x][y] < last-2 {
+				field[x][y]++
+			}
+			input >>= 2
+		}
+	}
+	field[randomartWidth/2][randomartHeight/2] = last - 1 // Start
+	field[x][y] = last                                    // End
+
+	var sb strings.Builder
+	sb.WriteString(randomartBorder(randomartTitle(key)) + "\n")
+	for y := 0; y < randomartHeight; y++ {
+		sb.WriteByte('|')
+		for x := 0; x < randomartWidth; x++ {
+			sb.WriteByte(randomartSymbols[field[x][y]])
+		}
+		sb.WriteString("|\n")
+	}
+	sb.WriteString(randomartBorder("[SHA256]"))
+	return sb.String()
+}
+
+// randomartBorder returns a border line with the label centered
+func randomartBorder(label string) string {
+	left := max(randomartWidth-len(label), 0) / 2
+	right := max(randomartWidth-left-len(label), 0)
+	return "+" + strings.Repeat("-", left) + label + strings.Repeat("-", right) + "+"
+}
+
+// randomartTitle names the key type and size like ssh-keygen, such as [ED25519 256]
+func randomartTitle(key ssh.PublicKey) string {
+	name, bits := key.Type(), 0
+	if crypto, ok := key.(ssh.CryptoPublicKey); ok {
+		switch pub := crypto.CryptoPublicKey().(type) {
+		case *rsa.PublicKey:
+			name, bits = "RSA", pub.N.BitLen()
+		case *ecdsa.PublicKey:
+			name, bits = "ECDSA", pub.Curve.Params().BitSize
+		case ed25519.PublicKey:
+			name, bits = "ED25519", 256
+		}
+	}
+	switch key.Type() {
+	case ssh.KeyAlgoSKED25519:
+		name, bits = "ED25519-SK", 256
+	case ssh.KeyAlgoSKECDSA256:
+		name, bits = "ECDSA-SK", 256
+	}
+	if title := fmt.Sprintf("[%s %d]", name, bits); bits > 0 && len(title) <= randomartWidth {
+		return title
+	}
+	return "[" + name + "]"
+}
@@ -0,0 +1,61 @@
+package hiddify_extension
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// validateRequestName checks that a global request name is a valid SSH algorithm-style name
+func validateRequestName(name string) error {
+	return validateSSHName("global request", name)
+}
+
+// validateSSHName checks a request or subsystem name follows the SSH naming rules
+func validateSSHName(what string, name string) error {
+	if name == "" {
+		return nil
+	}
+	if len(name) > 64 {
+		return fmt.Errorf("%s name must be at most 64 characters", what)
+	}
+	for _, r := range name {
+		if r <= ' ' || r > '~' || r == ',' {
+			return fmt.Errorf("%s name must be printable ASCII without spaces or commas", what)
+		}
+	}
+	return nil
+}
+
+// sendGlobalRequest sends the configured global request and logs the server's reply
+func (e *HiddifyExtensionSimpleSsh) sendGlobalRequest(client *ssh.Client) {
+	data := e.data()
+	name := data.GlobalRequest
+	ok, payload, err := client.SendRequest(name, true, []byte(data.GlobalRequestPayload))
+	if err != nil {
+		e.addAndUpdateConsole(red.Sprintf("Global request %q failed: ", name), err.Error())
+		return
+	}
+
+	reply := "accepted"
+	if !ok {
+		reply = "rejected"
+	}
+	if len(payload) > 0 {
+		reply += ", payload: " + formatPayload(payload)
+	}
+	e.addAndUpdateConsole(yellow.Sprintf("Global request %q: ", name), reply)
+}
+
+// formatPayload renders a reply payload as text when printable, otherwise as hex
+func formatPayload(payload []byte) string {
+	if utf8.Valid(payload) && strings.IndexFunc(string(payload), func(r rune) bool {
+		return r < ' ' && r != '\n' && r != '\t'
+	}) < 0 {
+		return string(payload)
+	}
+	return hex.EncodeToString(payload)
+}
@@ -0,0 +1,93 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Seconds allowed for the banner, key exchange and authentication once the transport is connected
+const defaultHandshakeTimeout = 15
+
+// Handshake phases, named in timeout errors
+const (
+	phaseBanner = "waiting for the server banner"
+	phaseKex    = "exchanging keys"
+	phaseAuth   = "authenticating"
+)
+
+// handshakeTracker records how far a handshake got
+type handshakeTracker struct {
+	net.Conn
+	received atomic.Bool // Whether the server sent anything, starting with its banner
+	verified atomic.Bool // Whether the host key was checked, ending the key exchange
+}
+
+// Read marks the banner as received on the first data from the server
+func (t *handshakeTracker) Read(p []byte) (int, error) {
+	n, err := t.Conn.Read(p)
+	if n > 0 {
+		t.received.Store(true)
+	}
+	return n, err
+}
+
+// phase names the handshake phase reached
+func (t *handshakeTracker) phase() string {
+	switch {
+	case t.verified.Load():
+		return phaseAuth
+	case t.received.Load():
+		return phaseKex
+	}
+	return phaseBanner
+}
+
+// handshake runs the SSH handshake over conn, closing it when the handshake takes longer than
+// HandshakeTimeout so a server that accepts the connection but stalls cannot hang the attempt
+func (e *HiddifyExtensionSimpleSsh) handshake(conn net.Conn, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	timeout := time.Duration(e.data().HandshakeTimeout) * time.Second
+	if timeout <= 0 {
+		c, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+		if err != nil {
+			return nil, err
+		}
+		return ssh.NewClient(c, chans, reqs), nil
+	}
+
+	tracker := &handshakeTracker{Conn: conn}
+	tracked := *config
+	tracked.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		tracker.verified.Store(true)
+		return config.HostKeyCallback(hostname, remote, key)
+	}
+
+	var mu sync.Mutex
+	var expired string // Phase the handshake was in when it timed out
+	timer := time.AfterFunc(timeout, func() {
+		mu.Lock()
+		expired = tracker.phase()
+		mu.Unlock()
+		conn.Close()
+	})
+	c, chans, reqs, err := ssh.NewClientConn(tracker, address, &tracked)
+	timer.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if expired != "" {
+		if err == nil {
+			c.Close()
+		}
+		e.addAndUpdateConsole(red.Sprint("Handshake timed out: "), fmt.Sprintf("%s after %v with %s", expired, timeout, address))
+		return nil, fmt.Errorf("handshake with %s timed out after %v while %s", address, timeout, expired)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
@@ -0,0 +1,58 @@
+package hiddify_extension
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestHandshakeBannerDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		delay   time.Duration
+		wantErr string // Empty when the handshake completes
+	}{
+		{"just under the timeout", 700 * time.Millisecond, ""},
+		{"past the timeout", 1500 * time.Millisecond, phaseBanner},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, "secret")
+			server.bannerDelay = tt.delay
+			e := newTestExtension(t, server)
+			e.Base.Data.HandshakeTimeout = 1
+
+			client, conn := net.Pipe()
+			go server.serve(newQueuedConn(conn))
+			config := &ssh.ClientConfig{
+				User:            "user",
+				Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+				HostKeyCallback: ssh.FixedHostKey(server.hostKey.PublicKey()),
+			}
+
+			start := time.Now()
+			c, err := e.handshake(client, "ssh.test:22", config)
+			elapsed := time.Since(start)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("handshake() error = %v", err)
+				}
+				c.Close()
+				return
+			}
+			if err == nil {
+				c.Close()
+				t.Fatal("handshake() succeeded past the timeout")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("handshake() error = %v, want it to name the phase %q", err, tt.wantErr)
+			}
+			if elapsed < time.Second || elapsed >= tt.delay {
+				t.Errorf("handshake() gave up after %v, want after the 1s timeout and before the banner", elapsed)
+			}
+		})
+	}
+}
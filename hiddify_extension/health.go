@@ -0,0 +1,89 @@
+package hiddify_extension
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// healthServer serves the local health endpoints for supervisors of headless deployments
+type healthServer struct {
+	mu     sync.Mutex
+	port   int          // Port currently served, 0 when stopped
+	server *http.Server // Running server, nil when stopped
+}
+
+// tunnelUp reports whether the command connection or the interactive shell is connected
+func (e *HiddifyExtensionSimpleSsh) tunnelUp() bool {
+	return e.State() == StateConnected // The shell runs as the lifecycle's task too
+}
+
+// healthHandler answers /healthz with 200 only while connected, and /ready whenever the
+// extension is loaded and answering requests
+func (e *HiddifyExtensionSimpleSsh) healthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if !e.tunnelUp() {
+			http.Error(w, string(e.State()), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, StateConnected)
+	})
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ready")
+	})
+	return mux
+}
+
+// syncHealthServer starts, moves or stops the health server to match the configured port
+func (e *HiddifyExtensionSimpleSsh) syncHealthServer() {
+	h := &e.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	port := e.data().HealthPort
+	if port == h.port {
+		return
+	}
+	if h.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		h.server.Shutdown(ctx)
+		cancel()
+		h.server, h.port = nil, 0
+		e.addAndUpdateConsole(yellow.Sprint("Health endpoint stopped"))
+	}
+	if port == 0 {
+		return
+	}
+
+	// Only local supervisors may ask
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		e.addAndUpdateConsole(red.Sprint("Failed to start health endpoint: "), err.Error())
+		return
+	}
+	h.server = &http.Server{Handler: e.healthHandler(), ReadHeaderTimeout: 5 * time.Second}
+	h.port = port
+	go func(server *http.Server) {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.addAndUpdateConsole(red.Sprint("Health endpoint failed: "), err.Error())
+		}
+	}(h.server)
+	e.addAndUpdateConsole(green.Sprint("Health endpoint: "), "http://"+address+"/healthz and /ready")
+}
+
+// stopHealthServer stops the health server, if running
+func (e *HiddifyExtensionSimpleSsh) stopHealthServer() {
+	h := &e.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.server != nil {
+		h.server.Close()
+		h.server, h.port = nil, 0
+	}
+}
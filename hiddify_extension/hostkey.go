@@ -0,0 +1,122 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Host key verification supplied by the embedding application
+var (
+	customHostKeyCallback   ssh.HostKeyCallback
+	customHostKeyCallbackMu sync.RWMutex
+)
+
+// SetHostKeyCallback lets the embedding application verify server host keys against its own
+// trust store. The callback replaces the built-in verification for every connection made by the
+// extension; pass nil to restore the built-in behavior.
+func SetHostKeyCallback(callback ssh.HostKeyCallback) {
+	customHostKeyCallbackMu.Lock()
+	defer customHostKeyCallbackMu.Unlock()
+	customHostKeyCallback = callback
+}
+
+// pinnedHostKey is a host key the server or a jump host is allowed to present
+type pinnedHostKey struct {
+	fingerprint string // SHA256 fingerprint of the key
+	label       string // Description used in logs
+	comment     string // Comment of the public key, the address of the jump host it belongs to if any
+}
+
+// hostPins returns the pins that apply to host: for a jump host those whose comment is its
+// address, for the server all others
+func hostPins(pins []pinnedHostKey, host string, hops []string) []pinnedHostKey {
+	hop := slices.Contains(hops, host)
+	var matching []pinnedHostKey
+	for _, pin := range pins {
+		if hop && pin.comment == host || !hop && !slices.Contains(hops, pin.comment) {
+			matching = append(matching, pin)
+		}
+	}
+	return matching
+}
+
+// parsePinnedHostKeys parses public keys in authorized_keys format or SHA256 fingerprints, one per line
+func parsePinnedHostKeys(value string) ([]pinnedHostKey, error) {
+	var pins []pinnedHostKey
+	for i, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "SHA256:") {
+			pins = append(pins, pinnedHostKey{fingerprint: line, label: line})
+			continue
+		}
+		key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("pinned host key on line %d is not a public key or SHA256 fingerprint", i+1)
+		}
+		label := key.Type() + " " + ssh.FingerprintSHA256(key)
+		if comment != "" {
+			label += " (" + comment + ")"
+		}
+		pins = append(pins, pinnedHostKey{fingerprint: ssh.FingerprintSHA256(key), label: label, comment: comment})
+	}
+	return pins, nil
+}
+
+// hostKeyCallback returns the custom host key verification if set, otherwise the checks against
+// the known_hosts file and the pinned keys, for the server and every jump host alike. A host with
+// neither is left to the trust policy.
+func (e *HiddifyExtensionSimpleSsh) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	customHostKeyCallbackMu.RLock()
+	defer customHostKeyCallbackMu.RUnlock()
+	if customHostKeyCallback != nil {
+		return customHostKeyCallback, nil
+	}
+
+	pins, err := parsePinnedHostKeys(e.data().HostKeys)
+	if err != nil {
+		return nil, err
+	}
+	hops, err := jumpHostAddresses(e.data().JumpHosts)
+	if err != nil {
+		return nil, err
+	}
+	knownHosts, err := e.knownHostsCallback()
+	if err != nil {
+		return nil, err
+	}
+	unknownHost := e.unknownHostCallback(hops)
+
+	// Any of the host's pinned keys is accepted, so old and new keys both work during a rotation
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		pins := hostPins(pins, hostname, hops)
+		if len(pins) == 0 && knownHosts == nil {
+			return unknownHost(hostname, remote, key)
+		}
+		if knownHosts != nil {
+			if err := knownHosts(hostname, remote, key); err != nil {
+				return err
+			}
+		}
+		if len(pins) == 0 {
+			return nil
+		}
+		fingerprint := ssh.FingerprintSHA256(key)
+		for i, pin := range pins {
+			if pin.fingerprint == fingerprint {
+				e.addAndUpdateConsole(green.Sprint("Host key matched: "), fmt.Sprintf("pinned key %d of %d for %s, %s", i+1, len(pins), hostname, pin.label))
+				return nil
+			}
+		}
+		e.addAndUpdateConsole(red.Sprint("Host key mismatch: "), fmt.Sprintf("%s presented %s %s, which is not among its %d pinned keys", hostname, key.Type(), fingerprint, len(pins)))
+		return fmt.Errorf("host key %s of %s is not pinned", fingerprint, hostname)
+	}, nil
+}
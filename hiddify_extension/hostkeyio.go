@@ -0,0 +1,245 @@
+package hiddify_extension
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Prefix of exported fingerprint pins, which known_hosts cannot hold as entries
+const fingerprintExportPrefix = "# fingerprint "
+
+// hostKeyImport counts the outcome of merging known_hosts entries into the pinned keys
+type hostKeyImport struct {
+	added      int // New keys pinned
+	duplicates int // Keys already pinned
+	otherHosts int // Entries for other hosts, left out
+	unusable   int // @revoked and @cert-authority entries, left out
+}
+
+// String summarizes the import for the console
+func (r hostKeyImport) String() string {
+	return fmt.Sprintf("%d added, %d already pinned, %d for other hosts skipped, %d revoked or CA entries skipped",
+		r.added, r.duplicates, r.otherHosts, r.unusable)
+}
+
+// serverHostNames returns the known_hosts names of the server at each of addresses
+func serverHostNames(addresses []string) []string {
+	names := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		names = append(names, knownhosts.Normalize(address))
+	}
+	return names
+}
+
+// exportHostKeys renders the pinned host keys in known_hosts format for the server, and keys
+// pinned for one of the jump hosts at hops for that host. Fingerprint pins have no key to write
+// and are kept as comments that the import reads back.
+func exportHostKeys(pinned string, hosts []string, hops []string) (string, error) {
+	if _, err := parsePinnedHostKeys(pinned); err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, line := range strings.Split(pinned, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "SHA256:"):
+			lines = append(lines, fingerprintExportPrefix+line)
+			continue
+		}
+		key, comment, _, _, _ := ssh.ParseAuthorizedKey([]byte(line)) // Checked above
+		entryHosts := hosts
+		if slices.Contains(hops, comment) {
+			entryHosts = []string{knownhosts.Normalize(comment)}
+		}
+		entry := knownhosts.Line(entryHosts, key)
+		if comment != "" {
+			entry += " " + comment
+		}
+		lines = append(lines, entry)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// mergeHostKeys adds the keys of known_hosts entries for the server, or for one of the jump
+// hosts at hops, to the pinned keys, skipping keys already pinned for that host and entries for
+// other hosts. Nothing is merged when any line is invalid.
+func mergeHostKeys(pinned string, text string, hosts []string, hops []string) (string, hostKeyImport, error) {
+	var report hostKeyImport
+	existing, err := parsePinnedHostKeys(pinned)
+	if err != nil {
+		return pinned, report, err
+	}
+	seen := make(map[string]bool) // Keyed by the jump host, empty for the server, and fingerprint
+	for _, pin := range existing {
+		host := ""
+		if slices.Contains(hops, pin.comment) {
+			host = pin.comment
+		}
+		seen[host+" "+pin.fingerprint] = true
+	}
+
+	var added []string
+	for i, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		var host, fingerprint, pin string
+		switch {
+		case strings.HasPrefix(line, fingerprintExportPrefix):
+			fingerprint = strings.TrimSpace(strings.TrimPrefix(line, fingerprintExportPrefix))
+			if _, err := parsePinnedHostKeys(fingerprint); err != nil || !strings.HasPrefix(fingerprint, "SHA256:") {
+				return pinned, report, fmt.Errorf("line %d is not a valid SHA256 fingerprint", i+1)
+			}
+			pin = fingerprint
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		default:
+			marker, entryHosts, key, comment, _, err := ssh.ParseKnownHosts([]byte(line))
+			if err != nil {
+				return pinned, report, fmt.Errorf("line %d is not a known_hosts entry: %w", i+1, err)
+			}
+			if marker != "" {
+				report.unusable++
+				continue
+			}
+			if !matchesAnyHost(entryHosts, hosts) {
+				host = jumpHostOf(entryHosts, hops)
+				if host == "" {
+					report.otherHosts++
+					continue
+				}
+				comment = host // Applies the pin to this jump host only
+			} else if slices.Contains(hops, comment) {
+				comment = "" // The server's key, not the jump host's
+			}
+			fingerprint = ssh.FingerprintSHA256(key)
+			pin = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+			if comment != "" {
+				pin += " " + comment
+			}
+		}
+		if seen[host+" "+fingerprint] {
+			report.duplicates++
+			continue
+		}
+		seen[host+" "+fingerprint] = true
+		added = append(added, pin)
+		report.added++
+	}
+
+	if len(added) == 0 {
+		return pinned, report, nil
+	}
+	merged := strings.TrimRight(pinned, "\n")
+	if strings.TrimSpace(merged) != "" {
+		merged += "\n"
+	}
+	return merged + strings.Join(added, "\n"), report, nil
+}
+
+// jumpHostOf returns the address of the first of the jump hosts at hops that the host patterns
+// of a known_hosts entry cover, empty if none
+func jumpHostOf(patterns []string, hops []string) string {
+	for _, hop := range hops {
+		if matchesAnyHost(patterns, []string{knownhosts.Normalize(hop)}) {
+			return hop
+		}
+	}
+	return ""
+}
+
+// matchesAnyHost reports whether the host patterns of a known_hosts entry cover any of the
+// names. Plain names, * and ? wildcards and hashed names are understood; an entry with a
+// matching negated pattern never matches.
+func matchesAnyHost(patterns []string, names []string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		for _, name := range names {
+			if !matchHostPattern(pattern, name) {
+				continue
+			}
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchHostPattern matches one known_hosts host pattern against a normalized name
+func matchHostPattern(pattern string, name string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		parts := strings.Split(pattern[len("|1|"):], "|")
+		if len(parts) != 2 {
+			return false
+		}
+		salt, err1 := base64.StdEncoding.DecodeString(parts[0])
+		hash, err2 := base64.StdEncoding.DecodeString(parts[1])
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(name))
+		return hmac.Equal(mac.Sum(nil), hash)
+	}
+	matched, err := path.Match(pattern, name)
+	return err == nil && matched
+}
+
+// serverAddresses returns the addresses the server may be reached at with the current ports
+func (e *HiddifyExtensionSimpleSsh) serverAddresses() []string {
+	var addresses []string
+	for _, port := range e.candidatePorts() {
+		addresses = append(addresses, net.JoinHostPort(e.data().IP, port))
+	}
+	return addresses
+}
+
+// showHostKeyExport shows the pinned host keys as known_hosts entries for backing them up
+func (e *HiddifyExtensionSimpleSsh) showHostKeyExport() {
+	hops, _ := jumpHostAddresses(e.data().JumpHosts) // Checked by the form
+	exported, err := exportHostKeys(e.data().HostKeys, serverHostNames(e.serverAddresses()), hops)
+	if err != nil {
+		e.ShowMessage("Cannot export host keys", err.Error())
+		return
+	}
+	if exported == "" {
+		e.ShowMessage("No host keys to export", "Pin the server's host keys first, for example from \"Show server host key\".")
+		return
+	}
+	e.ShowMessage("Pinned host keys (known_hosts)", exported)
+}
+
+// importHostKeys merges pasted known_hosts entries into the pinned host keys
+func (e *HiddifyExtensionSimpleSsh) importHostKeys(text string) {
+	if strings.TrimSpace(text) == "" {
+		e.ShowMessage("Nothing to import", "Paste known_hosts entries into \"Import Host Keys\" first.")
+		return
+	}
+	hops, _ := jumpHostAddresses(e.data().JumpHosts) // Checked by the form
+	addresses := serverHostNames(e.serverAddresses())
+	e.dataMu.Lock()
+	merged, report, err := mergeHostKeys(e.Base.Data.HostKeys, text, addresses, hops)
+	if err == nil {
+		e.Base.Data.HostKeys = merged
+	}
+	e.dataMu.Unlock()
+	if err != nil {
+		e.addAndUpdateConsole(red.Sprint("Host key import failed: "), err.Error())
+		e.ShowMessage("Cannot import host keys", err.Error())
+		return
+	}
+	e.addAndUpdateConsole(green.Sprint("Host keys imported: "), report.String())
+}
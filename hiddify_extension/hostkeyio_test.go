@@ -0,0 +1,110 @@
+package hiddify_extension
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// pinFingerprints returns the fingerprints of the pins in pinned for host, sorted
+func pinFingerprints(t *testing.T, pinned string, host string, hops []string) []string {
+	t.Helper()
+	pins, err := parsePinnedHostKeys(pinned)
+	if err != nil {
+		t.Fatalf("parsePinnedHostKeys() error = %v", err)
+	}
+	var fingerprints []string
+	for _, pin := range hostPins(pins, host, hops) {
+		fingerprints = append(fingerprints, pin.fingerprint)
+	}
+	slices.Sort(fingerprints)
+	return fingerprints
+}
+
+func TestHostKeyRoundTrip(t *testing.T) {
+	server, hop := newTestServer(t, ""), newTestServer(t, "")
+	hosts, hops := serverHostNames([]string{"ssh.test:22", "ssh.test:2222"}), []string{"jump.test:22"}
+	pinned := strings.Join([]string{
+		"# Rotated in 2026",
+		server.pin() + " current",
+		ssh.FingerprintSHA256(newTestServer(t, "").hostKey.PublicKey()),
+		hop.pin() + " jump.test:22",
+	}, "\n")
+
+	exported, err := exportHostKeys(pinned, hosts, hops)
+	if err != nil {
+		t.Fatalf("exportHostKeys() error = %v", err)
+	}
+	imported, report, err := mergeHostKeys("", exported, hosts, hops)
+	if err != nil {
+		t.Fatalf("mergeHostKeys() error = %v", err)
+	}
+	if report.added != 3 {
+		t.Errorf("import report = %s, want 3 added", report)
+	}
+	for _, host := range []string{"ssh.test:22", "jump.test:22"} {
+		if got, want := pinFingerprints(t, imported, host, hops), pinFingerprints(t, pinned, host, hops); !slices.Equal(got, want) {
+			t.Errorf("pins of %s after the round trip = %q, want %q", host, got, want)
+		}
+	}
+
+	// Importing the export again adds nothing
+	merged, report, err := mergeHostKeys(imported, exported, hosts, hops)
+	if err != nil {
+		t.Fatalf("mergeHostKeys() error = %v", err)
+	}
+	if merged != imported || report.added != 0 || report.duplicates != 3 {
+		t.Errorf("reimport report = %s, want every key already pinned", report)
+	}
+}
+
+func TestMergeHostKeys(t *testing.T) {
+	server, other := newTestServer(t, ""), newTestServer(t, "")
+	key := server.hostKey.PublicKey()
+	hosts := serverHostNames([]string{"ssh.test:22"})
+
+	tests := []struct {
+		name string
+		text string
+		want hostKeyImport
+	}{
+		{"plain", knownhosts.Line([]string{"ssh.test"}, key), hostKeyImport{added: 1}},
+		{"hashed", knownhosts.Line([]string{knownhosts.HashHostname("ssh.test")}, key), hostKeyImport{added: 1}},
+		{"wildcard", knownhosts.Line([]string{"*.test"}, key), hostKeyImport{added: 1}},
+		{"negated", knownhosts.Line([]string{"*.test", "!ssh.test"}, key), hostKeyImport{otherHosts: 1}},
+		{"duplicates", knownhosts.Line([]string{"ssh.test"}, key) + "\n" + knownhosts.Line([]string{knownhosts.HashHostname("ssh.test")}, key), hostKeyImport{added: 1, duplicates: 1}},
+		{"other host", knownhosts.Line([]string{"other.test"}, other.hostKey.PublicKey()), hostKeyImport{otherHosts: 1}},
+		{"comments and markers", "# backup\n\n@revoked ssh.test " + server.pin() + "\n@cert-authority *.test " + other.pin(), hostKeyImport{unusable: 2}},
+		{"fingerprint", fingerprintExportPrefix + ssh.FingerprintSHA256(key), hostKeyImport{added: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, report, err := mergeHostKeys("", tt.text, hosts, nil)
+			if err != nil {
+				t.Fatalf("mergeHostKeys() error = %v", err)
+			}
+			if report != tt.want {
+				t.Errorf("report = %s, want %s", report, tt.want)
+			}
+			if _, err := parsePinnedHostKeys(merged); err != nil {
+				t.Errorf("merged pins %q do not parse: %v", merged, err)
+			}
+		})
+	}
+}
+
+func TestMergeHostKeysInvalid(t *testing.T) {
+	pinned := newTestServer(t, "").pin()
+	for _, text := range []string{"ssh.test not-a-key", fingerprintExportPrefix + "MD5:00"} {
+		merged, _, err := mergeHostKeys(pinned, text, []string{"ssh.test"}, nil)
+		if err == nil {
+			t.Errorf("mergeHostKeys(%q) accepted an invalid line", text)
+		}
+		if merged != pinned {
+			t.Errorf("mergeHostKeys(%q) changed the pins on failure", text)
+		}
+	}
+}
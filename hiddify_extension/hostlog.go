@@ -0,0 +1,23 @@
+package hiddify_extension
+
+import (
+	"strings"
+
+	"github.com/sagernet/sing-box/log"
+)
+
+// Prefix marking this extension's lines in the host log
+const hostLogPrefix = "[simple-ssh] "
+
+// logToHost mirrors a console line to the global logger hiddify-core and sing-box write to,
+// so it shows up in the app's logs next to the core's own messages
+func (e *HiddifyExtensionSimpleSsh) logToHost(line string) {
+	if !e.data().HostLog {
+		return
+	}
+	line = strings.TrimRight(plainLine(line), "\n")
+	if line == "" {
+		return
+	}
+	log.Info(hostLogPrefix + line)
+}
@@ -0,0 +1,197 @@
+package hiddify_extension
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// jumpHop is a bastion host the connection passes through on the way to the server
+type jumpHop struct {
+	user    string // Username for this hop, empty to reuse the configured one
+	address string // host:port of the hop
+}
+
+// String describes the hop
+func (h jumpHop) String() string {
+	if h.user == "" {
+		return h.address
+	}
+	return h.user + "@" + h.address
+}
+
+// parseJumpHosts parses a comma-separated list of [user@]host[:port] hops. Passwords have their
+// own field, so they never end up in logs that show the hops.
+func parseJumpHosts(value string) ([]jumpHop, error) {
+	var hops []jumpHop
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		var hop jumpHop
+		hostPort := entry
+		if idx := strings.LastIndex(entry, "@"); idx >= 0 {
+			var hasPassword bool
+			hop.user, _, hasPassword = strings.Cut(entry[:idx], ":")
+			hostPort = entry[idx+1:]
+			if hasPassword {
+				return nil, fmt.Errorf("jump host %q contains a password, enter it in \"Jump Host Password\" instead", jumpHop{user: hop.user, address: hostPort})
+			}
+		}
+		host, port, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			host, port = strings.Trim(hostPort, "[]"), "22"
+		}
+		if host == "" || strings.ContainsAny(host, " /") {
+			return nil, fmt.Errorf("invalid jump host %q", jumpHop{user: hop.user, address: hostPort})
+		}
+		if _, err := net.LookupPort("tcp", port); err != nil {
+			return nil, fmt.Errorf("jump host %q has an invalid port", jumpHop{user: hop.user, address: hostPort})
+		}
+		hop.address = net.JoinHostPort(host, port)
+		hops = append(hops, hop)
+	}
+	return hops, nil
+}
+
+// jumpHostAddresses returns the host:port of each configured jump host
+func jumpHostAddresses(value string) ([]string, error) {
+	hops, err := parseJumpHosts(value)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, 0, len(hops))
+	for _, hop := range hops {
+		addresses = append(addresses, hop.address)
+	}
+	return addresses, nil
+}
+
+// hopConfig returns the client configuration for a hop, applying its own user if set
+func hopConfig(config *ssh.ClientConfig, hop jumpHop, auth []ssh.AuthMethod) *ssh.ClientConfig {
+	hopConfig := *config
+	if hop.user != "" {
+		hopConfig.User = hop.user
+	}
+	hopConfig.Auth = auth
+	return &hopConfig
+}
+
+// jumpAuth returns the authentication offered to jump hosts: the server's keys, which reveal
+// nothing to a host that is not the server, and the jump host password. The server password is
+// only offered when sharing it is enabled, since every hop could read it.
+func (e *HiddifyExtensionSimpleSsh) jumpAuth(auth []ssh.AuthMethod) []ssh.AuthMethod {
+	data := e.data()
+	var methods []ssh.AuthMethod
+	var serverPassword ssh.AuthMethod
+	for _, method := range auth {
+		if _, ok := method.(passwordAuth); ok {
+			serverPassword = method
+			continue
+		}
+		methods = append(methods, method)
+	}
+
+	// Only one password is tried per host, the jump host password comes first
+	switch {
+	case data.JumpPassword != "":
+		methods = append(methods, ssh.Password(data.JumpPassword))
+	case serverPassword != nil && data.JumpShareAuth:
+		methods = append(methods, serverPassword)
+		e.addAndUpdateConsole(yellow.Sprint("Jump hosts: "), "offering the server password, as sharing it is enabled")
+	case serverPassword != nil:
+		e.addAndUpdateConsole(yellow.Sprint("Jump hosts: "), "the server password is not offered, set \"Jump Host Password\" or enable sharing it")
+	}
+	return methods
+}
+
+// dialChain connects to the server through the configured jump hosts, each one reached
+// through the previous. Closing the returned client closes the whole chain.
+func (e *HiddifyExtensionSimpleSsh) dialChain(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	hops, err := parseJumpHosts(e.data().JumpHosts)
+	if err != nil {
+		return nil, err
+	}
+	if len(hops) == 0 {
+		return e.dial(ctx, address, config)
+	}
+
+	chain := make([]string, 0, len(hops)+1)
+	for _, hop := range hops {
+		chain = append(chain, hop.String())
+	}
+	e.addAndUpdateConsole(yellow.Sprint("Jump chain: "), strings.Join(append(chain, address), " -> "))
+	auth := e.jumpAuth(config.Auth)
+
+	// The first hop is reached over the configured transport
+	var mu sync.Mutex
+	var clients []*ssh.Client
+	addClient := func(c *ssh.Client) {
+		mu.Lock()
+		clients = append(clients, c)
+		mu.Unlock()
+	}
+	closeAll := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+	client, err := e.dial(ctx, hops[0].address, hopConfig(config, hops[0], auth))
+	if err != nil {
+		return nil, fmt.Errorf("jump host 1 (%s): %w", hops[0], err)
+	}
+	addClient(client)
+
+	// Abort a stalled handshake through the chain when cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			closeAll()
+		case <-done:
+		}
+	}()
+
+	// Each further hop, and finally the server, is reached through the previous hop
+	for i := 1; i <= len(hops); i++ {
+		target, targetConfig, name := address, config, "target server"
+		if i < len(hops) {
+			target, targetConfig, name = hops[i].address, hopConfig(config, hops[i], auth), fmt.Sprintf("jump host %d (%s)", i+1, hops[i])
+		}
+
+		conn, err := client.Dial("tcp", target)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("%s unreachable from jump host %d: %w", name, i, err)
+		}
+		conn = e.traceConn(conn, "tunnel", target)
+		client, err = e.handshake(conn, target, targetConfig)
+		if err != nil {
+			conn.Close()
+			closeAll()
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		addClient(client)
+	}
+
+	// Tear down the jump hosts once the final connection ends
+	mu.Lock()
+	jumps := clients[:len(clients)-1]
+	mu.Unlock()
+	go func() {
+		client.Wait()
+		for i := len(jumps) - 1; i >= 0; i-- {
+			jumps[i].Close()
+		}
+	}()
+	return client, nil
+}
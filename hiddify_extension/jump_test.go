@@ -0,0 +1,99 @@
+package hiddify_extension
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newJumpTestExtension returns an extension that reaches server through the jump host hop, with
+// both host keys pinned
+func newJumpTestExtension(t *testing.T, hop *testServer, server *testServer) *HiddifyExtensionSimpleSsh {
+	t.Helper()
+	hop.next = server
+	e := newTestExtension(t, server)
+	e.SetDialer(hop.dialer())
+	e.Base.Data.JumpHosts = "bastion@jump.test"
+	e.Base.Data.HostKeys = server.pin() + "\n" + hop.pin() + " jump.test:22"
+	return e
+}
+
+func TestJumpHostKeyChecked(t *testing.T) {
+	hop, server := newTestServer(t, "hop-secret"), newTestServer(t, "secret")
+	e := newJumpTestExtension(t, hop, server)
+	e.Base.Data.JumpPassword = "hop-secret"
+
+	client, err := e.connect(context.Background())
+	if err != nil {
+		t.Fatalf("connect() error = %v", err)
+	}
+	client.Close()
+
+	// The server's pin does not apply to the jump host
+	e.Base.Data.HostKeys = server.pin() + "\n" + newTestServer(t, "").pin() + " jump.test:22"
+	if _, err := e.connect(context.Background()); err == nil {
+		t.Fatal("connect() accepted a jump host key that is not pinned for it")
+	}
+	if offered := hop.offered(); len(offered) != 1 {
+		t.Errorf("jump host was offered passwords %q before its key was verified", offered[1:])
+	}
+}
+
+func TestJumpHostPassword(t *testing.T) {
+	tests := []struct {
+		name         string
+		hopPassword  string
+		jumpPassword string
+		share        bool
+		wantErr      bool
+	}{
+		{"jump host password", "hop-secret", "hop-secret", false, false},
+		{"server password withheld", "secret", "", false, true},
+		{"server password shared", "secret", "", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hop, server := newTestServer(t, tt.hopPassword), newTestServer(t, "secret")
+			e := newJumpTestExtension(t, hop, server)
+			e.Base.Data.JumpPassword = tt.jumpPassword
+			e.Base.Data.JumpShareAuth = tt.share
+
+			client, err := e.connect(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("connect() error = %v, want error %v", err, tt.wantErr)
+			}
+			if client != nil {
+				client.Close()
+			}
+			if !tt.share && slices.Contains(hop.offered(), "secret") {
+				t.Error("the server password was offered to the jump host")
+			}
+		})
+	}
+}
+
+func TestParseJumpHostsRejectsPasswords(t *testing.T) {
+	_, err := parseJumpHosts("bastion:hop-secret@jump.test")
+	if err == nil {
+		t.Fatal("parseJumpHosts() accepted an inline password")
+	}
+	if strings.Contains(err.Error(), "hop-secret") {
+		t.Errorf("error %q shows the password", err)
+	}
+}
+
+func TestMigrateJumpPasswords(t *testing.T) {
+	var d HiddifyExtensionSimpleSshData
+	saved := `{"jump_hosts": "a:first@one.test, b@two.test,c:second@three.test:2222"}`
+	if err := json.Unmarshal([]byte(saved), &d); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a@one.test, b@two.test,c@three.test:2222"; d.JumpHosts != want {
+		t.Errorf("JumpHosts = %q, want %q", d.JumpHosts, want)
+	}
+	if d.JumpPassword != "first" {
+		t.Errorf("JumpPassword = %q, want the first inline password", d.JumpPassword)
+	}
+}
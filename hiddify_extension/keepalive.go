@@ -0,0 +1,63 @@
+package hiddify_extension
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Default keepalive settings, mirroring common OpenSSH client configurations
+const (
+	defaultServerAliveInterval = 15
+	defaultServerAliveCountMax = 3
+)
+
+// keepAlive probes the server every ServerAliveInterval seconds and closes the connection
+// once ServerAliveCountMax probes in a row go unanswered
+func (e *HiddifyExtensionSimpleSsh) keepAlive(ctx context.Context, client *ssh.Client) {
+	data := e.data()
+	interval := time.Duration(data.ServerAliveInterval) * time.Second
+	countMax := data.ServerAliveCountMax
+	if interval <= 0 || countMax <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Any reply, even a failure, proves the server is alive
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-reply:
+			if err != nil {
+				return // Connection already closed
+			}
+			missed = 0
+			continue
+		case <-time.After(interval):
+			missed++
+		}
+
+		if missed >= countMax {
+			e.addAndUpdateConsole(red.Sprint("Server keepalive timeout: "), (interval*time.Duration(countMax)).String()+" without a response, closing connection")
+			client.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package hiddify_extension
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveTimeout(t *testing.T) {
+	server := newTestServer(t, "secret")
+	server.silent = true
+	e := newTestExtension(t, server)
+	e.Base.Data.ServerAliveInterval, e.Base.Data.ServerAliveCountMax = 1, 1
+
+	client, err := e.connect(context.Background())
+	if err != nil {
+		t.Fatalf("connect() error = %v", err)
+	}
+	defer client.Close()
+
+	// The timeout is logged while other tasks write to the console
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		e.keepAlive(context.Background(), client)
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			e.addAndUpdateConsole("other task")
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+	wg.Wait()
+
+	closed := make(chan error, 1)
+	go func() { closed <- client.Wait() }()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("keepAlive() returned without closing the connection")
+	}
+	if !strings.Contains(e.consoleText(), "Server keepalive timeout") {
+		t.Errorf("console does not report the keepalive timeout:\n%s", e.consoleText())
+	}
+}
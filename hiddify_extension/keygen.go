@@ -0,0 +1,95 @@
+package hiddify_extension
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Key types offered by the key pair generator
+const (
+	KeyTypeED25519 = "ed25519"
+	KeyTypeECDSA   = "ecdsa"
+	KeyTypeRSA     = "rsa"
+)
+
+// Settings of generated keys
+const (
+	generatedKeyComment = "hiddify-simple-ssh"
+	generatedRSABits    = 3072
+)
+
+// validKeyType reports whether keyType can be generated
+func validKeyType(keyType string) bool {
+	switch keyType {
+	case KeyTypeED25519, KeyTypeECDSA, KeyTypeRSA:
+		return true
+	}
+	return false
+}
+
+// generatePrivateKey creates a new private key of the given type
+func generatePrivateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case KeyTypeED25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case KeyTypeECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeRSA:
+		return rsa.GenerateKey(rand.Reader, generatedRSABits)
+	default:
+		return nil, fmt.Errorf("unknown key type %q", keyType)
+	}
+}
+
+// generateKeyPair creates a key pair, stores the private key in the form encrypted with the
+// passphrase, if any, and shows the public key. The key is never sent anywhere.
+func (e *HiddifyExtensionSimpleSsh) generateKeyPair() {
+	data := e.data()
+	// Do not replace keys the user pasted
+	if strings.TrimSpace(data.PrivateKey) != "" {
+		e.ShowMessage("Private key already set", "Clear the Private Key field to generate a new key pair.")
+		return
+	}
+
+	key, err := generatePrivateKey(data.KeyType)
+	if err != nil {
+		e.ShowMessage("Cannot generate key pair", err.Error())
+		return
+	}
+	var block *pem.Block
+	if data.Passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, generatedKeyComment, []byte(data.Passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(key, generatedKeyComment)
+	}
+	if err != nil {
+		e.ShowMessage("Cannot generate key pair", err.Error())
+		return
+	}
+	publicKey, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		e.ShowMessage("Cannot generate key pair", err.Error())
+		return
+	}
+
+	e.dataMu.Lock()
+	e.Base.Data.PrivateKey = string(pem.EncodeToMemory(block))
+	e.dataMu.Unlock()
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))) + " " + generatedKeyComment
+	encrypted := "unencrypted, set a Key Passphrase before generating to encrypt it"
+	if data.Passphrase != "" {
+		encrypted = "encrypted with the key passphrase"
+	}
+	e.addAndUpdateConsole(green.Sprint("Generated key pair: "), publicKey.Type()+" "+ssh.FingerprintSHA256(publicKey)+" ("+encrypted+")")
+	e.ShowMessage("Public Key", "The private key was added to the form. Add this line to ~/.ssh/authorized_keys on the server:\n\n"+authorizedKey)
+}
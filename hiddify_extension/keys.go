@@ -0,0 +1,340 @@
+package hiddify_extension
+
+import (
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Number of keys offered by default, below OpenSSH's default MaxAuthTries of 6
+const defaultMaxKeys = 5
+
+// Preferred order of agent key types, strongest and fastest first
+var agentKeyOrder = []string{
+	ssh.KeyAlgoED25519, ssh.KeyAlgoSKED25519,
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521, ssh.KeyAlgoSKECDSA256,
+	ssh.KeyAlgoRSA,
+}
+
+// Key types backed by FIDO2 security keys
+var securityKeyTypes = []string{ssh.KeyAlgoSKED25519, ssh.KeyAlgoSKECDSA256}
+
+// errNoAuthMethod is returned when no credentials are configured
+var errNoAuthMethod = errors.New("no authentication method is configured: enter a password, paste a private key or enable \"Use SSH Agent\"")
+
+// requireAuthMethod checks that at least one authentication method is configured
+func requireAuthMethod(data HiddifyExtensionSimpleSshData) error {
+	if data.Password == "" && strings.TrimSpace(data.PrivateKey) == "" && !data.UseAgent {
+		return errNoAuthMethod
+	}
+	return nil
+}
+
+// authMethods builds the SSH authentication methods from the configured credentials.
+// The returned cleanup function releases the SSH agent connection, if any.
+func (e *HiddifyExtensionSimpleSsh) authMethods() ([]ssh.AuthMethod, func(), error) {
+	data := e.data()
+	var methods []ssh.AuthMethod
+	var names []string
+	keys := 0
+	cleanup := func() {}
+
+	// Prefer public key authentication when private keys are provided
+	if strings.TrimSpace(data.PrivateKey) != "" {
+		blocks := splitPrivateKeys(data.PrivateKey)
+		var signers []ssh.Signer
+		for i, block := range blocks {
+			label := "Private key"
+			if len(blocks) > 1 {
+				label = fmt.Sprintf("Private key %d", i+1)
+			}
+
+			keyType := privateKeyType(block)
+			switch {
+			case slices.Contains(securityKeyTypes, keyType) && !data.UseAgent:
+				return nil, cleanup, fmt.Errorf("%s security keys need a touch through ssh-agent: add the key to your agent and enable \"Use SSH Agent\"", keyType)
+			case slices.Contains(securityKeyTypes, keyType):
+				e.addAndUpdateConsole(yellow.Sprint(label+" type: "), keyType+" (signed through the SSH agent)")
+			default:
+				signer, err := parsePrivateKey(block, data.Passphrase)
+				if err != nil && len(blocks) == 1 {
+					return nil, cleanup, err
+				}
+				if err != nil {
+					e.addAndUpdateConsole(red.Sprint("Skipping "+strings.ToLower(label)+": "), err.Error())
+					continue
+				}
+				e.addAndUpdateConsole(yellow.Sprint(label+" type: "), signer.PublicKey().Type()+keyEncryptionNote(block))
+				signers = append(signers, e.reportAcceptedKey(signer, label))
+			}
+		}
+
+		// Keep within the server's MaxAuthTries
+		if data.MaxKeys > 0 && len(signers) > data.MaxKeys {
+			e.addAndUpdateConsole(yellow.Sprintf("Offering %d of %d private keys", data.MaxKeys, len(signers)))
+			signers = signers[:data.MaxKeys]
+		}
+		if len(signers) > 0 {
+			methods = append(methods, ssh.PublicKeys(signers...))
+			names = append(names, "publickey")
+			keys += len(signers)
+		} else if len(blocks) > 1 && !data.UseAgent {
+			return nil, cleanup, errors.New("none of the private keys could be loaded")
+		}
+	}
+
+	// Offer the keys held by the local SSH agent
+	if data.UseAgent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, cleanup, errors.New("SSH agent requested but SSH_AUTH_SOCK is not set")
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("failed to connect to SSH agent: %w", err)
+		}
+		cleanup = func() { conn.Close() }
+
+		// Limit the agent keys so the server's MaxAuthTries is not exhausted
+		limit := -1
+		if data.MaxKeys > 0 {
+			limit = max(data.MaxKeys-keys, 0)
+		}
+		client := agent.NewClient(conn)
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			signers, err := client.Signers()
+			if err != nil {
+				return nil, err
+			}
+			sortSigners(signers)
+			if limit >= 0 && len(signers) > limit {
+				e.addAndUpdateConsole(yellow.Sprintf("Offering %d of %d agent keys", limit, len(signers)))
+				signers = signers[:limit]
+			} else {
+				e.addAndUpdateConsole(yellow.Sprintf("Offering %d agent keys", len(signers)))
+			}
+			return signers, nil
+		}))
+		names = append(names, "agent")
+	}
+
+	if data.Password != "" {
+		methods = append(methods, passwordAuth{ssh.Password(data.Password)})
+		names = append(names, "password")
+	}
+
+	e.addAndUpdateConsole(yellow.Sprintf("Authentication methods (%d): ", len(methods)), strings.Join(names, ", "))
+	return methods, cleanup, nil
+}
+
+// passwordAuth marks the server password among the authentication methods, so it can be
+// withheld from jump hosts
+type passwordAuth struct {
+	ssh.AuthMethod
+}
+
+// sortSigners orders signers by the preferred key types, keeping the agent order otherwise
+func sortSigners(signers []ssh.Signer) {
+	rank := func(s ssh.Signer) int {
+		if idx := slices.Index(agentKeyOrder, s.PublicKey().Type()); idx >= 0 {
+			return idx
+		}
+		return len(agentKeyOrder)
+	}
+	slices.SortStableFunc(signers, func(a, b ssh.Signer) int {
+		return rank(a) - rank(b)
+	})
+}
+
+// splitPrivateKeys splits pasted text into individual PEM, OpenSSH and PuTTY key blocks.
+// Text without recognizable blocks is returned as a single key.
+func splitPrivateKeys(text string) []string {
+	var blocks []string
+	var current []string
+	var end string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if end == "" {
+			switch {
+			case strings.HasPrefix(trimmed, "-----BEGIN "):
+				end = "-----END "
+			case strings.HasPrefix(trimmed, ppkHeaderPrefix):
+				end = "Private-MAC:"
+			default:
+				continue // Ignore text between keys
+			}
+		}
+		current = append(current, trimmed)
+		if strings.HasPrefix(trimmed, end) {
+			blocks = append(blocks, strings.Join(current, "\n"))
+			current, end = nil, ""
+		}
+	}
+	if len(blocks) == 0 {
+		return []string{text}
+	}
+	return blocks
+}
+
+// reportAcceptedKey wraps a signer to log when the server accepts its key and asks for a signature
+func (e *HiddifyExtensionSimpleSsh) reportAcceptedKey(signer ssh.Signer, label string) ssh.Signer {
+	multi, ok := signer.(ssh.MultiAlgorithmSigner)
+	if !ok {
+		return signer
+	}
+	return acceptedKeySigner{MultiAlgorithmSigner: multi, accepted: func() {
+		key := signer.PublicKey()
+		e.addAndUpdateConsole(green.Sprint(label+" accepted: "), key.Type()+" "+ssh.FingerprintSHA256(key))
+	}}
+}
+
+// acceptedKeySigner calls accepted before signing, which only happens once the server accepted the key
+type acceptedKeySigner struct {
+	ssh.MultiAlgorithmSigner
+	accepted func()
+}
+
+// Sign reports the key and signs data
+func (s acceptedKeySigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	s.accepted()
+	return s.MultiAlgorithmSigner.Sign(rand, data)
+}
+
+// SignWithAlgorithm reports the key and signs data with the given algorithm
+func (s acceptedKeySigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	s.accepted()
+	return s.MultiAlgorithmSigner.SignWithAlgorithm(rand, data, algorithm)
+}
+
+// Ciphers and KDFs golang.org/x/crypto/ssh decrypts OpenSSH private keys with
+var (
+	openSSHKeyCiphers = []string{"none", "aes256-ctr", "aes256-cbc"}
+	openSSHKeyKDFs    = []string{"none", "bcrypt"}
+)
+
+// openSSHKeyHeader holds the unencrypted settings at the start of an OpenSSH private key
+type openSSHKeyHeader struct {
+	cipher  string // Cipher encrypting the private part, "none" when unencrypted
+	kdf     string // KDF deriving the cipher key from the passphrase, "none" when unencrypted
+	rounds  uint32 // bcrypt rounds, 0 when unencrypted
+	keyType string // Type of the stored public key
+}
+
+// parseOpenSSHKeyHeader reads the header of a "BEGIN OPENSSH PRIVATE KEY" block. ok is false for
+// other formats and damaged keys, which are left to the full parser to report.
+func parseOpenSSHKeyHeader(key string) (header openSSHKeyHeader, ok bool) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(key)))
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+		return header, false
+	}
+
+	// The public key is stored unencrypted after the cipher and KDF settings
+	const magic = "openssh-key-v1\x00"
+	if !strings.HasPrefix(string(block.Bytes), magic) {
+		return header, false
+	}
+	r := &sshWireReader{buf: block.Bytes[len(magic):]}
+	header.cipher = string(r.string())
+	header.kdf = string(r.string())
+	kdfOptions := r.string()
+	if r.err != nil || len(r.buf) < 4 {
+		return header, false
+	}
+	r.buf = r.buf[4:] // number of keys
+	pub, err := ssh.ParsePublicKey(r.string())
+	if r.err != nil || err != nil {
+		return header, false
+	}
+	header.keyType = pub.Type()
+
+	if header.kdf == "bcrypt" {
+		options := &sshWireReader{buf: kdfOptions}
+		options.string() // salt
+		if options.err != nil || len(options.buf) < 4 {
+			return header, false
+		}
+		header.rounds = binary.BigEndian.Uint32(options.buf)
+	}
+	return header, true
+}
+
+// checkOpenSSHKeyEncryption reports encryption settings golang.org/x/crypto/ssh cannot decrypt,
+// such as the AEAD ciphers ssh-keygen -Z accepts, with how to convert the key
+func checkOpenSSHKeyEncryption(header openSSHKeyHeader) error {
+	if !slices.Contains(openSSHKeyKDFs, header.kdf) {
+		return fmt.Errorf("private key uses the unsupported KDF %q, only bcrypt is supported", header.kdf)
+	}
+	if !slices.Contains(openSSHKeyCiphers, header.cipher) {
+		return fmt.Errorf("private key is encrypted with the unsupported cipher %q, only aes256-ctr and aes256-cbc are supported: re-encrypt it with \"ssh-keygen -p -Z aes256-ctr -f <file>\"", header.cipher)
+	}
+	if (header.kdf == "none") != (header.cipher == "none") {
+		return fmt.Errorf("private key pairs cipher %q with KDF %q and is malformed", header.cipher, header.kdf)
+	}
+	return nil
+}
+
+// keyEncryptionNote describes how an encrypted OpenSSH private key is protected, since many
+// bcrypt rounds make loading it noticeably slow
+func keyEncryptionNote(key string) string {
+	header, ok := parseOpenSSHKeyHeader(key)
+	if !ok || header.kdf != "bcrypt" {
+		return ""
+	}
+	return fmt.Sprintf(" (encrypted with %s, bcrypt %d rounds)", header.cipher, header.rounds)
+}
+
+// privateKeyType returns the key type stored in an OpenSSH private key, or an empty string
+func privateKeyType(key string) string {
+	header, _ := parseOpenSSHKeyHeader(key)
+	return header.keyType
+}
+
+// parsePrivateKey parses an OpenSSH, PEM or PuTTY private key into a signer
+func parsePrivateKey(key string, passphrase string) (ssh.Signer, error) {
+	data := []byte(strings.TrimSpace(key))
+
+	// PuTTY keys are converted to an OpenSSH-compatible signer
+	if isPPK(data) {
+		signer, err := parsePPK(data, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert PuTTY key: %w", err)
+		}
+		return signer, nil
+	}
+
+	// Name the problem with new-format keys rather than relying on the parser's generic errors
+	header, isOpenSSH := parseOpenSSHKeyHeader(key)
+	if isOpenSSH {
+		if err := checkOpenSSHKeyEncryption(header); err != nil {
+			return nil, err
+		}
+	}
+
+	if passphrase != "" {
+		if isOpenSSH && header.cipher == "none" {
+			return ssh.ParsePrivateKey(data) // The passphrase is not needed, and the parser would reject it
+		}
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			return nil, errors.New("incorrect private key passphrase")
+		}
+		return signer, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, errors.New("private key is encrypted, please enter its passphrase")
+	}
+	return signer, err
+}
@@ -0,0 +1,114 @@
+package hiddify_extension
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Names checked against known_hosts entries, like OpenSSH's CheckHostIP
+const (
+	KnownHostsMatchHostname = "hostname" // The configured server name only
+	KnownHostsMatchIP       = "ip"       // The IP address the connection reached only
+	KnownHostsMatchBoth     = "both"     // Both must be known with the presented key
+)
+
+// validKnownHostsMatch reports whether match is a known matching mode
+func validKnownHostsMatch(match string) bool {
+	switch match {
+	case KnownHostsMatchHostname, KnownHostsMatchIP, KnownHostsMatchBoth:
+		return true
+	}
+	return false
+}
+
+// knownHostsCallback checks host keys against the configured known_hosts file.
+// It returns nil when no file is configured.
+func (e *HiddifyExtensionSimpleSsh) knownHostsCallback() (ssh.HostKeyCallback, error) {
+	data := e.data()
+	path := strings.TrimSpace(data.KnownHostsFile)
+	if path == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = home + path[1:]
+	}
+	check, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+
+	match := data.KnownHostsMatch
+	e.addAndUpdateConsole(yellow.Sprint("Known hosts: "), path+" (matching "+match+")")
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		// Both names come from the dialed host:port, the remote address may be a proxy or a stream
+		if match != KnownHostsMatchIP {
+			if err := e.checkKnownHost(check, "hostname", hostname, hostname, hostAddr(hostname), key); err != nil {
+				return err
+			}
+		}
+		if match != KnownHostsMatchHostname {
+			ip := dialedIP(hostname, remote)
+			if ip == nil {
+				// Name-resolving proxies, jump hosts and custom transports hide the server's address
+				e.addAndUpdateConsole(red.Sprint("Host IP unknown: "), fmt.Sprintf("connected to %s through %v, the IP cannot be checked", hostname, remote))
+				return errors.New("host IP is unknown and cannot be checked against known_hosts")
+			}
+			_, port, _ := net.SplitHostPort(hostname)
+			address := net.JoinHostPort(ip.String(), port)
+			// The knownhosts package checks the remote address when no hostname is given
+			if err := e.checkKnownHost(check, "IP", address, "", hostAddr(address), key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// dialedIP returns the IP the connection to hostname reached: the remote address of a direct
+// connection, or the host itself when an IP was dialed. It is nil when neither is known.
+func dialedIP(hostname string, remote net.Addr) net.IP {
+	if tcpAddr, ok := remote.(*net.TCPAddr); ok && !tcpAddr.IP.IsUnspecified() {
+		return tcpAddr.IP
+	}
+	host, _, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// checkKnownHost runs check for a single name and logs the outcome
+func (e *HiddifyExtensionSimpleSsh) checkKnownHost(check ssh.HostKeyCallback, kind string, name string, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	err := check(hostname, remote, key)
+	fingerprint := key.Type() + " " + ssh.FingerprintSHA256(key)
+
+	var keyErr *knownhosts.KeyError
+	var revokedErr *knownhosts.RevokedError
+	switch {
+	case err == nil:
+		e.addAndUpdateConsole(green.Sprint("Known host matched: "), kind+" "+knownhosts.Normalize(name))
+	case errors.As(err, &keyErr) && len(keyErr.Want) == 0:
+		e.addAndUpdateConsole(red.Sprint("Unknown host "+kind+": "), knownhosts.Normalize(name)+" is not in known_hosts, server presented "+fingerprint)
+	case errors.As(err, &keyErr):
+		var want []string
+		for _, known := range keyErr.Want {
+			want = append(want, fmt.Sprintf("%s:%d", known.Filename, known.Line))
+		}
+		e.addAndUpdateConsole(red.Sprint("Known host "+kind+" mismatch: "), fmt.Sprintf("%s presented %s, known_hosts expects the key at %s", knownhosts.Normalize(name), fingerprint, strings.Join(want, ", ")))
+	case errors.As(err, &revokedErr):
+		e.addAndUpdateConsole(red.Sprint("Host key revoked: "), fmt.Sprintf("%s at %s:%d", fingerprint, revokedErr.Revoked.Filename, revokedErr.Revoked.Line))
+	default:
+		e.addAndUpdateConsole(red.Sprint("Known hosts check failed: "), err.Error())
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package hiddify_extension
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestKnownHosts(t *testing.T) {
+	server := newTestServer(t, "secret")
+	key := server.hostKey.PublicKey()
+	other := newTestServer(t, "").hostKey.PublicKey()
+
+	tests := []struct {
+		name    string
+		host    string
+		port    string
+		match   string
+		entries []string
+		wantErr bool
+	}{
+		{"plain", "ssh.test", "22", KnownHostsMatchHostname, []string{knownhosts.Line([]string{"ssh.test"}, key)}, false},
+		{"hashed", "ssh.test", "22", KnownHostsMatchHostname, []string{knownhosts.Line([]string{knownhosts.HashHostname("ssh.test")}, key)}, false},
+		{"port", "ssh.test", "2222", KnownHostsMatchHostname, []string{knownhosts.Line([]string{"[ssh.test]:2222"}, key)}, false},
+		{"port not matched", "ssh.test", "2222", KnownHostsMatchHostname, []string{knownhosts.Line([]string{"ssh.test"}, key)}, true},
+		{"other key", "ssh.test", "22", KnownHostsMatchHostname, []string{knownhosts.Line([]string{"ssh.test"}, other)}, true},
+		{"revoked", "ssh.test", "22", KnownHostsMatchHostname, []string{knownhosts.Line([]string{"ssh.test"}, key), "@revoked * " + server.pin()}, true},
+		{"ip dialed", "192.0.2.1", "22", KnownHostsMatchIP, []string{knownhosts.Line([]string{"192.0.2.1"}, key)}, false},
+		{"ip unknown", "ssh.test", "22", KnownHostsMatchBoth, []string{knownhosts.Line([]string{"ssh.test"}, key)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "known_hosts")
+			if err := os.WriteFile(path, []byte(strings.Join(tt.entries, "\n")+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			e := newTestExtension(t, server)
+			e.Base.Data.IP, e.Base.Data.Port = tt.host, tt.port
+			e.Base.Data.HostKeys = ""
+			e.Base.Data.KnownHostsFile = path
+			e.Base.Data.KnownHostsMatch = tt.match
+
+			client, err := e.connect(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("connect() error = %v, want error %v", err, tt.wantErr)
+			}
+			if client != nil {
+				client.Close()
+			}
+		})
+	}
+}
+
+func TestKnownHostsOverStream(t *testing.T) {
+	server := newTestServer(t, "secret")
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(path, []byte(knownhosts.Line([]string{"ssh.test"}, server.hostKey.PublicKey())+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e := newTestExtension(t, server)
+	e.SetDialer(StreamDialer(func(ctx context.Context) (io.ReadWriteCloser, error) {
+		client, conn := net.Pipe()
+		go server.serve(newQueuedConn(conn))
+		return struct{ io.ReadWriteCloser }{client}, nil // Hides net.Conn, so the stream has no address
+	}))
+	e.Base.Data.HostKeys = ""
+	e.Base.Data.KnownHostsFile = path
+	e.Base.Data.KnownHostsMatch = KnownHostsMatchHostname
+
+	client, err := e.connect(context.Background())
+	if err != nil {
+		t.Fatalf("connect() error = %v", err)
+	}
+	client.Close()
+}
+
+func TestDialedIP(t *testing.T) {
+	client, _ := net.Pipe()
+	tests := []struct {
+		name     string
+		hostname string
+		remote   net.Addr
+		want     string
+	}{
+		{"direct", "ssh.test:22", &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 22}, "192.0.2.1"},
+		{"proxied name", "ssh.test:22", tunneledConn{Conn: client, target: "ssh.test:22"}.RemoteAddr(), ""},
+		{"proxied ip", "ssh.test:22", tunneledConn{Conn: client, target: "192.0.2.1:22"}.RemoteAddr(), "192.0.2.1"},
+		{"jump host", "ssh.test:22", &net.TCPAddr{IP: net.IPv4zero}, ""},
+		{"ip dialed", "192.0.2.2:22", streamAddr{}, "192.0.2.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dialedIP(tt.hostname, tt.remote)
+			if got == nil && tt.want != "" || got != nil && got.String() != tt.want {
+				t.Errorf("dialedIP() = %v, want %q", got, tt.want)
+			}
+		})
+	}
+}
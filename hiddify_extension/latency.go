@@ -0,0 +1,87 @@
+package hiddify_extension
+
+import (
+	"strings"
+	"time"
+)
+
+// Number of latency samples kept when none is configured
+const defaultLatencySamples = 20
+
+// Sparkline bar characters from lowest to highest
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// latencyHistory is a ring buffer of the most recent latency samples
+type latencyHistory struct {
+	samples []time.Duration // Sample storage
+	next    int             // Index of the next sample to overwrite
+	count   int             // Number of stored samples
+}
+
+// newLatencyHistory creates a ring buffer holding up to size samples
+func newLatencyHistory(size int) *latencyHistory {
+	if size < 1 {
+		size = 1
+	}
+	return &latencyHistory{samples: make([]time.Duration, size)}
+}
+
+// add records a new sample, overwriting the oldest one when full
+func (h *latencyHistory) add(sample time.Duration) {
+	h.samples[h.next] = sample
+	h.next = (h.next + 1) % len(h.samples)
+	if h.count < len(h.samples) {
+		h.count++
+	}
+}
+
+// values returns the stored samples from oldest to newest
+func (h *latencyHistory) values() []time.Duration {
+	values := make([]time.Duration, 0, h.count)
+	start := (h.next - h.count + len(h.samples)) % len(h.samples)
+	for i := 0; i < h.count; i++ {
+		values = append(values, h.samples[(start+i)%len(h.samples)])
+	}
+	return values
+}
+
+// resize changes the buffer capacity, keeping the most recent samples
+func (h *latencyHistory) resize(size int) {
+	if size < 1 {
+		size = 1
+	}
+	if size == len(h.samples) {
+		return
+	}
+	values := h.values()
+	if len(values) > size {
+		values = values[len(values)-size:]
+	}
+	*h = *newLatencyHistory(size)
+	for _, v := range values {
+		h.add(v)
+	}
+}
+
+// sparkline renders the stored samples as a bar graph scaled between min and max
+func (h *latencyHistory) sparkline() string {
+	values := h.values()
+	if len(values) == 0 {
+		return ""
+	}
+
+	low, high := values[0], values[0]
+	for _, v := range values {
+		low, high = min(low, v), max(high, v)
+	}
+
+	var sb strings.Builder
+	for _, v := range values {
+		idx := 0
+		if high > low {
+			idx = int(int64(v-low) * int64(len(sparkBars)-1) / int64(high-low))
+		}
+		sb.WriteRune(sparkBars[idx])
+	}
+	return sb.String()
+}
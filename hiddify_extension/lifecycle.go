@@ -0,0 +1,181 @@
+package hiddify_extension
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ConnectionState is a stage in the lifecycle of the command connection
+type ConnectionState string
+
+// Connection lifecycle states
+const (
+	StateIdle         ConnectionState = "idle"
+	StateConnecting   ConnectionState = "connecting"
+	StateReconnecting ConnectionState = "reconnecting" // Replacing a running task, e.g. after a settings change
+	StateConnected    ConnectionState = "connected"
+	StateStopping     ConnectionState = "stopping"
+	StateFailed       ConnectionState = "failed"
+)
+
+// Allowed lifecycle transitions; starting while a task runs reconnects in its place
+var stateTransitions = map[ConnectionState][]ConnectionState{
+	StateIdle:         {StateConnecting},
+	StateConnecting:   {StateReconnecting, StateConnected, StateStopping, StateFailed, StateIdle},
+	StateReconnecting: {StateReconnecting, StateConnected, StateStopping, StateFailed, StateIdle},
+	StateConnected:    {StateReconnecting, StateStopping, StateIdle},
+	StateStopping:     {StateIdle},
+	StateFailed:       {StateConnecting, StateIdle},
+}
+
+// active reports whether a task is connecting or connected; the caller must hold mu
+func (l *lifecycle) active() bool {
+	return l.state == StateConnecting || l.state == StateReconnecting || l.state == StateConnected
+}
+
+// dialing reports whether a task is still connecting; the caller must hold mu
+func (l *lifecycle) dialing() bool {
+	return l.state == StateConnecting || l.state == StateReconnecting
+}
+
+// lifecycle tracks the background task state shared by SubmitData, Cancel, Stop and the task itself
+type lifecycle struct {
+	mu       sync.Mutex
+	state    ConnectionState
+	task     uint64              // Identifies the current background task
+	cancel   context.CancelFunc  // Cancels the current background task
+	settings *connectionSettings // Settings of the current task, nil if it must not be reused
+}
+
+// transition moves to the next state if allowed; the caller must hold mu
+func (l *lifecycle) transition(next ConnectionState) error {
+	current := l.state
+	if current == "" {
+		current = StateIdle
+	}
+	if !slices.Contains(stateTransitions[current], next) {
+		return fmt.Errorf("cannot go from %s to %s", current, next)
+	}
+	l.state = next
+	return nil
+}
+
+// start cancels any running task and begins a new one, returning its context and id. A running
+// task with the same settings is kept and errAlreadyRunning returned; nil settings always restart.
+func (l *lifecycle) start(settings *connectionSettings) (context.Context, uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	next := StateConnecting
+	if l.active() {
+		if settings != nil && l.settings != nil && *settings == *l.settings {
+			return nil, 0, errAlreadyRunning
+		}
+		next = StateReconnecting
+	}
+	if err := l.transition(next); err != nil {
+		return nil, 0, fmt.Errorf("previous connection is still %s", l.state)
+	}
+	if l.cancel != nil {
+		l.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l.task++
+	l.cancel = cancel
+	l.settings = settings
+	return ctx, l.task, nil
+}
+
+// running returns the settings of the running task, or nil when none is running or it must not be reused
+func (l *lifecycle) running() *connectionSettings {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.active() {
+		return nil
+	}
+	return l.settings
+}
+
+// connected records that the task finished connecting
+func (l *lifecycle) connected(task uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if task == l.task && l.dialing() {
+		l.transition(StateConnected)
+	}
+}
+
+// failed records that the task gave up connecting, which it stays in until the next connect or cancel
+func (l *lifecycle) failed(task uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if task == l.task && l.dialing() {
+		l.transition(StateFailed)
+	}
+}
+
+// finished records that the task ended; stale tasks replaced by a newer one are ignored
+func (l *lifecycle) finished(task uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if task == l.task {
+		if l.state != StateFailed {
+			l.transition(StateIdle)
+		}
+		l.cancel = nil
+	}
+}
+
+// stop cancels the running task, which returns to idle once it has exited. A failed
+// connection has no task left and is cleared right away.
+func (l *lifecycle) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state == StateFailed {
+		l.transition(StateIdle)
+		return
+	}
+	if l.transition(StateStopping) == nil {
+		l.cancel()
+	}
+}
+
+// current returns the current state
+func (l *lifecycle) current() ConnectionState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state == "" {
+		return StateIdle
+	}
+	return l.state
+}
+
+// State returns the current state of the command connection
+func (e *HiddifyExtensionSimpleSsh) State() ConnectionState {
+	return e.lifecycle.current()
+}
+
+// notifyReady reports the connection outcome to a caller waiting in SubmitData, if any
+func notifyReady(ready chan<- error, err error) {
+	if ready != nil {
+		ready <- err // Buffered, never blocks
+	}
+}
+
+// waitReady blocks until the connection outcome is reported, or gives up after timeout. The
+// handshake has no limit when its timeout is 0, so the wait cannot rely on the connect ending.
+func waitReady(ready <-chan error, timeout time.Duration) error {
+	if ready == nil {
+		return nil
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-ready:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("not connected after %v, still trying in the background", timeout)
+	}
+}
@@ -0,0 +1,250 @@
+package hiddify_extension
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hiddify/hiddify-core/extension/ui"
+)
+
+func TestWaitReady(t *testing.T) {
+	if err := waitReady(nil, time.Millisecond); err != nil {
+		t.Errorf("waitReady() without a caller waiting = %v, want nil", err)
+	}
+
+	ready := make(chan error, 1)
+	failed := errors.New("refused")
+	notifyReady(ready, failed)
+	if err := waitReady(ready, time.Second); err != failed {
+		t.Errorf("waitReady() = %v, want the reported outcome", err)
+	}
+
+	// A handshake without a timeout may never report, the wait still ends
+	if err := waitReady(make(chan error, 1), 10*time.Millisecond); err == nil {
+		t.Error("waitReady() without an outcome returned nil, want a timeout error")
+	}
+}
+
+func TestReadyTimeout(t *testing.T) {
+	e := NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh)
+	e.Base.Data.HandshakeTimeout = 0
+	e.Base.Data.ConnectAttempts = 2
+	e.Base.Data.ConnectTimeout, e.Base.Data.ConnectTimeoutMax = 5, 30
+	e.Base.Data.FallbackPorts = ""
+
+	// Dial and handshake for 5s, a 1s delay, then dial and handshake for 10s
+	if got, want := e.readyTimeout(), 31*time.Second; got != want {
+		t.Errorf("readyTimeout() = %v, want %v", got, want)
+	}
+
+	e.Base.Data.JumpHosts = "jump.test"
+	if got, want := e.readyTimeout(), 61*time.Second; got != want {
+		t.Errorf("readyTimeout() through a jump host = %v, want %v", got, want)
+	}
+}
+
+func TestLifecycleTransition(t *testing.T) {
+	tests := []struct {
+		from    ConnectionState
+		to      ConnectionState
+		wantErr bool
+	}{
+		{StateIdle, StateConnecting, false},
+		{StateConnecting, StateConnected, false},
+		{StateConnecting, StateFailed, false},
+		{StateConnected, StateStopping, false},
+		{StateStopping, StateIdle, false},
+		{StateFailed, StateConnecting, false},
+		{StateConnected, StateReconnecting, false},
+		{StateConnecting, StateReconnecting, false},
+		{StateReconnecting, StateConnected, false},
+		{StateReconnecting, StateFailed, false},
+		{StateReconnecting, StateStopping, false},
+		{StateIdle, StateConnected, true},
+		{StateIdle, StateStopping, true},
+		{StateConnected, StateFailed, true},
+		{StateStopping, StateConnecting, true},
+		{StateStopping, StateConnected, true},
+		{StateFailed, StateConnected, true},
+		{StateIdle, StateReconnecting, true},
+		{StateFailed, StateReconnecting, true},
+		{StateConnected, StateConnecting, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+" to "+string(tt.to), func(t *testing.T) {
+			l := &lifecycle{state: tt.from}
+			err := l.transition(tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("transition() error = %v, want error %v", err, tt.wantErr)
+			}
+			want := tt.to
+			if tt.wantErr {
+				want = tt.from // Rejected transitions leave the state alone
+			}
+			if l.state != want {
+				t.Errorf("state = %s, want %s", l.state, want)
+			}
+		})
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	var l lifecycle
+	steps := []struct {
+		name string
+		do   func(task uint64)
+		want ConnectionState
+	}{
+		{"start", nil, StateConnecting},
+		{"connected", l.connected, StateConnected},
+		{"stop", func(uint64) { l.stop() }, StateStopping},
+		{"stale task ignored", func(task uint64) { l.finished(task + 1) }, StateStopping},
+		{"finished", l.finished, StateIdle},
+	}
+
+	_, task, err := l.start(nil)
+	if err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+	for _, step := range steps {
+		if step.do != nil {
+			step.do(task)
+		}
+		if got := l.current(); got != step.want {
+			t.Fatalf("after %s, state = %s, want %s", step.name, got, step.want)
+		}
+	}
+}
+
+func TestLifecycleStartWhileStopping(t *testing.T) {
+	var l lifecycle
+	ctx, task, _ := l.start(nil)
+	l.stop()
+	if ctx.Err() == nil {
+		t.Error("stop() did not cancel the task")
+	}
+	if _, _, err := l.start(nil); err == nil {
+		t.Error("start() succeeded while the previous task is stopping")
+	}
+	l.finished(task)
+	if _, _, err := l.start(nil); err != nil {
+		t.Errorf("start() after the task exited error = %v", err)
+	}
+}
+
+func TestLifecycleFailed(t *testing.T) {
+	var l lifecycle
+	_, task, _ := l.start(nil)
+	l.failed(task)
+	l.finished(task)
+	if got := l.current(); got != StateFailed {
+		t.Fatalf("state = %s, want %s kept after the task exits", got, StateFailed)
+	}
+	l.stop()
+	if got := l.current(); got != StateIdle {
+		t.Errorf("state after stop() = %s, want %s", got, StateIdle)
+	}
+}
+
+func TestLifecycleReconnect(t *testing.T) {
+	var l lifecycle
+	first, task, _ := l.start(nil)
+	l.connected(task)
+	second, task, err := l.start(nil)
+	if err != nil {
+		t.Fatalf("start() while connected error = %v", err)
+	}
+	if first.Err() == nil {
+		t.Error("reconnecting did not cancel the previous task")
+	}
+	if got := l.current(); got != StateReconnecting {
+		t.Fatalf("state = %s, want %s", got, StateReconnecting)
+	}
+	l.finished(task - 1) // The replaced task exits
+	if got := l.current(); got != StateReconnecting {
+		t.Fatalf("state after the replaced task exits = %s, want %s", got, StateReconnecting)
+	}
+	l.connected(task)
+	if got := l.current(); got != StateConnected {
+		t.Errorf("state = %s, want %s", got, StateConnected)
+	}
+	if second.Err() != nil {
+		t.Error("the new task was cancelled")
+	}
+}
+
+func TestLifecycleConcurrent(t *testing.T) {
+	var l lifecycle
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				_, task, err := l.start(nil)
+				switch j % 4 {
+				case 0:
+					l.stop()
+				case 1:
+					l.failed(task)
+				default:
+					l.connected(task)
+				}
+				if err == nil {
+					l.finished(task)
+				}
+				if state := l.current(); stateTransitions[state] == nil {
+					t.Errorf("state = %q, want a known state", state)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Whatever the interleaving, one stop settles the lifecycle
+	l.stop()
+	if state := l.current(); !slices.Contains([]ConnectionState{StateIdle, StateStopping}, state) {
+		t.Errorf("state after stop() = %s, want idle or stopping", state)
+	}
+}
+
+func TestSubmitDataConcurrent(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+	e.toHost = func(ui.Form) error { return nil } // The form is shown once submitted
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				e.SubmitData(map[string]string{CommandKey: fmt.Sprintf("echo %d.%d", i, j), ConnectAttemptsKey: "1"})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				e.Cancel()
+				e.State()
+				e.form()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every task exits once cancelled
+	e.Cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for e.State() != StateIdle {
+		if time.Now().After(deadline) {
+			t.Fatalf("State() = %s after Cancel, want %s", e.State(), StateIdle)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,130 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Default log file rotation settings
+const (
+	defaultLogMaxSizeKB = 1024
+	defaultLogMaxFiles  = 3
+)
+
+// Matches the ANSI color sequences used in the console
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// rotatingLog appends lines to a file, rotating it to path.1, path.2, ... when it grows too large
+type rotatingLog struct {
+	mu      sync.Mutex
+	path    string   // Path of the open file
+	file    *os.File // Open log file, nil when closed
+	size    int64    // Current file size
+	lastErr string   // Last reported error, to warn only once per failure
+}
+
+// write appends a line, opening or rotating the file as needed. An error is only returned
+// when it differs from the previous one so the console is not flooded with warnings.
+func (l *rotatingLog) write(path string, maxSize int64, maxFiles int, line string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := l.writeLocked(path, maxSize, maxFiles, line)
+	if err == nil {
+		l.lastErr = ""
+		return nil
+	}
+	if err.Error() == l.lastErr {
+		return nil
+	}
+	l.lastErr = err.Error()
+	return err
+}
+
+// writeLocked does the work of write; the caller must hold mu
+func (l *rotatingLog) writeLocked(path string, maxSize int64, maxFiles int, line string) error {
+	if l.file != nil && l.path != path {
+		l.closeLocked()
+	}
+	if l.file == nil {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		l.file, l.path, l.size = file, path, info.Size()
+	}
+
+	if l.size > 0 && l.size+int64(len(line)) > maxSize {
+		if err := l.rotateLocked(maxFiles); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.WriteString(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotateLocked shifts the old files up by one, dropping the oldest, and starts a new file
+func (l *rotatingLog) rotateLocked(maxFiles int) error {
+	path := l.path
+	l.closeLocked()
+	for i := maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+	}
+	if maxFiles > 0 {
+		os.Rename(path, path+".1")
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	l.file, l.path, l.size = file, path, 0
+	return nil
+}
+
+// close closes the log file, if open
+func (l *rotatingLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closeLocked()
+}
+
+// closeLocked closes the log file; the caller must hold mu
+func (l *rotatingLog) closeLocked() {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// logToFile mirrors a console line to the log file without colors or secrets,
+// returning a warning for the console if writing failed
+func (e *HiddifyExtensionSimpleSsh) logToFile(line string) string {
+	data := e.data()
+	if data.LogFilePath == "" {
+		e.logFile.close()
+		return ""
+	}
+
+	line = time.Now().Format(time.RFC3339) + " " + plainLine(line)
+
+	err := e.logFile.write(data.LogFilePath, int64(data.LogMaxSizeKB)*1024, data.LogMaxFiles, line)
+	if err != nil {
+		return red.Sprint("Failed to write log file: ") + err.Error() + "\n"
+	}
+	return ""
+}
+
+// plainLine strips the colors from a console line. Secrets never reach the console: URLs are
+// logged through redactURL, jump hosts carry no passwords and credentials are never formatted.
+func plainLine(line string) string {
+	return ansiPattern.ReplaceAllString(line, "")
+}
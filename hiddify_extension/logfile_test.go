@@ -0,0 +1,57 @@
+package hiddify_extension
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlainLine(t *testing.T) {
+	line := green.Sprint("Connected: ") + "a.test"
+	if got := plainLine(line); got != "Connected: a.test" {
+		t.Errorf("plainLine() = %q, want the text without colors", got)
+	}
+}
+
+func TestConsoleOmitsCredentials(t *testing.T) {
+	hop, server := newTestServer(t, "hop-secret"), newTestServer(t, "server-secret")
+	e := newJumpTestExtension(t, hop, server)
+	e.Base.Data.JumpPassword = "hop-secret"
+	e.Base.Data.Passphrase = "key-secret"
+
+	client, err := e.connect(context.Background())
+	if err != nil {
+		t.Fatalf("connect() error = %v", err)
+	}
+	client.Close()
+	for _, secret := range []string{"hop-secret", "server-secret", "key-secret"} {
+		if strings.Contains(e.consoleText(), secret) {
+			t.Errorf("console contains %q:\n%s", secret, e.consoleText())
+		}
+	}
+}
+
+func TestDialWebSocketCredentials(t *testing.T) {
+	authorization := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization <- r.Header.Get("Authorization")
+		http.Error(w, "no WebSocket here", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	wsURL := strings.Replace(server.URL, "http://", "ws://ws-user:ws-secret@", 1) + "/ssh"
+	_, err := dialWebSocket(context.Background(), &net.Dialer{Timeout: 5 * time.Second}, nil, wsURL, false)
+	if err == nil {
+		t.Fatal("dialWebSocket() succeeded against a plain HTTP server")
+	}
+	if strings.Contains(err.Error(), "ws-user") || strings.Contains(err.Error(), "ws-secret") {
+		t.Errorf("error %q contains the URL's credentials", err)
+	}
+	if got := <-authorization; got != "Basic d3MtdXNlcjp3cy1zZWNyZXQ=" {
+		t.Errorf("Authorization = %q, want the URL's credentials as basic auth", got)
+	}
+}
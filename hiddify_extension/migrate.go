@@ -0,0 +1,174 @@
+package hiddify_extension
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// Keys persisted by the demo extension template this extension started from
+var templateDataKeys = []string{"count", "input", "password", "email", "selected", "textarea", "switchVal", "radiobox", "content"}
+
+// UnmarshalJSON loads persisted settings on top of the current values, which hold the defaults.
+// Data saved by the extension template is recognized by its "count" key and its keys are dropped,
+// values of the wrong type are skipped instead of failing the whole load, and out of range values
+// fall back to their defaults.
+func (d *HiddifyExtensionSimpleSshData) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+
+	// The template's password was never an SSH password
+	if _, ok := fields["count"]; ok {
+		for _, key := range templateDataKeys {
+			delete(fields, key)
+		}
+	}
+
+	// Decode field by field so one bad value does not discard the rest
+	type plain HiddifyExtensionSimpleSshData // Avoids recursing into this method
+	defaults := *d
+	for key, value := range fields {
+		single, _ := json.Marshal(map[string]json.RawMessage{key: value})
+		json.Unmarshal(single, (*plain)(d))
+	}
+
+	d.moveJumpPasswords()
+	d.escapePercentSigns()
+	d.restoreInvalidDefaults(defaults)
+
+	// Provisioned settings can be forced over the saved ones
+	if forceBootstrapConfig() {
+		if data, source, err := loadBootstrapConfig(*d); source != "" && err == nil {
+			*d = data
+		}
+	}
+	return nil
+}
+
+// moveJumpPasswords moves passwords saved inline in the jump hosts, as user:password@host, to the
+// jump host password field. It holds a single password, so the first one found is kept.
+func (d *HiddifyExtensionSimpleSshData) moveJumpPasswords() {
+	entries := strings.Split(d.JumpHosts, ",")
+	for i, entry := range entries {
+		idx := strings.LastIndex(entry, "@")
+		if idx < 0 {
+			continue
+		}
+		user, password, ok := strings.Cut(entry[:idx], ":")
+		if !ok {
+			continue
+		}
+		if d.JumpPassword == "" {
+			d.JumpPassword = password
+		}
+		entries[i] = user + entry[idx:]
+	}
+	d.JumpHosts = strings.Join(entries, ",")
+}
+
+// escapePercentSigns escapes every % in remote commands saved before tokens were supported, so
+// that "date +%s" keeps running as written. Since the form rejects a command with an unknown
+// token, one that fails to expand must predate tokens; commands that expand are kept as saved.
+func (d *HiddifyExtensionSimpleSshData) escapePercentSigns() {
+	for _, commands := range []*string{&d.Command, &d.DiagnosticCommands, &d.PostConnectSteps} {
+		if validateTokens(*commands) != nil {
+			*commands = strings.ReplaceAll(*commands, "%", "%%")
+		}
+	}
+}
+
+// restoreInvalidDefaults resets loaded values that the form would reject to their defaults
+func (d *HiddifyExtensionSimpleSshData) restoreInvalidDefaults(defaults HiddifyExtensionSimpleSshData) {
+	if !slices.Contains([]string{ModeCommand, ModeShell, ModeSubsystem}, d.Mode) {
+		d.Mode = defaults.Mode
+	}
+	if d.Subsystem == "" || validateSSHName("subsystem", d.Subsystem) != nil {
+		d.Subsystem = defaults.Subsystem
+	}
+	if _, ok := algorithmPresets[d.AlgorithmPreset]; !ok {
+		d.AlgorithmPreset = defaults.AlgorithmPreset
+	}
+	if !validFingerprintFormat(d.FingerprintFormat) {
+		d.FingerprintFormat = defaults.FingerprintFormat
+	}
+	if !validTrustPolicy(d.TrustPolicy) {
+		d.TrustPolicy = defaults.TrustPolicy
+	}
+	if !validKnownHostsMatch(d.KnownHostsMatch) {
+		d.KnownHostsMatch = defaults.KnownHostsMatch
+	}
+	if validateUpstream(*d) != nil {
+		d.UpstreamOutbound = defaults.UpstreamOutbound
+	}
+	if validateTransport(*d) != nil {
+		d.Transport, d.WebSocketURL = defaults.Transport, defaults.WebSocketURL
+	}
+	if d.DSCP < 0 || d.DSCP > maxDSCP {
+		d.DSCP = defaults.DSCP
+	}
+	if !validKeyType(d.KeyType) {
+		d.KeyType = defaults.KeyType
+	}
+	if d.ForwardAgent && !d.UseAgent {
+		d.ForwardAgent = false
+	}
+	if d.MaxKeys < 0 {
+		d.MaxKeys = defaults.MaxKeys
+	}
+	if d.RekeyThreshold != 0 && d.RekeyThreshold < minRekeyThreshold {
+		d.RekeyThreshold = defaults.RekeyThreshold
+	}
+	if d.ConsoleWidth < 0 || (d.ConsoleWidth > 0 && d.ConsoleWidth < minConsoleWidth) {
+		d.ConsoleWidth = defaults.ConsoleWidth
+	}
+	if d.LatencySamples < 1 {
+		d.LatencySamples = defaults.LatencySamples
+	}
+	if d.SpeedTestMB < 1 || d.SpeedTestMB > maxSpeedTestMB {
+		d.SpeedTestMB = defaults.SpeedTestMB
+	}
+	if d.ServerAliveInterval < 0 {
+		d.ServerAliveInterval = defaults.ServerAliveInterval
+	}
+	if d.ServerAliveCountMax < 1 {
+		d.ServerAliveCountMax = defaults.ServerAliveCountMax
+	}
+	if d.ConnectTimeout < 1 || d.ConnectTimeoutMax < d.ConnectTimeout {
+		d.ConnectTimeout, d.ConnectTimeoutMax = defaults.ConnectTimeout, defaults.ConnectTimeoutMax
+	}
+	if d.HandshakeTimeout < 0 {
+		d.HandshakeTimeout = defaults.HandshakeTimeout
+	}
+	if d.ConnectAttempts < 1 {
+		d.ConnectAttempts = defaults.ConnectAttempts
+	}
+	if d.ConnectRate < 0 {
+		d.ConnectRate = defaults.ConnectRate
+	}
+	if d.HealthPort < 0 || d.HealthPort > 65535 {
+		d.HealthPort = defaults.HealthPort
+	}
+	if validateMTUProbe(*d) != nil {
+		d.MTUProbe, d.MTUProbeMin, d.MTUProbeMax = false, defaults.MTUProbeMin, defaults.MTUProbeMax
+	}
+	if d.ShellColumns < 1 {
+		d.ShellColumns = defaults.ShellColumns
+	}
+	if d.ShellRows < 1 {
+		d.ShellRows = defaults.ShellRows
+	}
+	if d.TranscriptMaxKB < 1 {
+		d.TranscriptMaxKB = defaults.TranscriptMaxKB
+	}
+	if d.TraceMaxSizeKB < 1 {
+		d.TraceMaxSizeKB = defaults.TraceMaxSizeKB
+	}
+	if d.LogMaxSizeKB < 1 {
+		d.LogMaxSizeKB = defaults.LogMaxSizeKB
+	}
+	if d.LogMaxFiles < 0 {
+		d.LogMaxFiles = defaults.LogMaxFiles
+	}
+}
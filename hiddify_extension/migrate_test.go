@@ -0,0 +1,97 @@
+package hiddify_extension
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// loadSaved decodes saved settings over the defaults, as the host does on startup
+func loadSaved(t *testing.T, saved string) (loaded, defaults HiddifyExtensionSimpleSshData) {
+	t.Helper()
+	defaults = NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh).Base.Data
+	loaded = defaults
+	if err := json.Unmarshal([]byte(saved), &loaded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	return loaded, defaults
+}
+
+func TestUnmarshalTemplateData(t *testing.T) {
+	loaded, defaults := loadSaved(t, `{"count": 3, "input": "demo", "password": "template-secret", "email": "a@b.test", "ip": "ssh.test"}`)
+	if loaded.Password != defaults.Password {
+		t.Errorf("Password = %q, the template's password must be dropped", loaded.Password)
+	}
+	if loaded.IP != "ssh.test" {
+		t.Errorf("IP = %q, want the saved value kept", loaded.IP)
+	}
+
+	// Without the template's "count" key, "password" is the SSH password
+	loaded, _ = loadSaved(t, `{"password": "ssh-secret"}`)
+	if loaded.Password != "ssh-secret" {
+		t.Errorf("Password = %q, want the saved SSH password", loaded.Password)
+	}
+}
+
+func TestUnmarshalWrongTypes(t *testing.T) {
+	loaded, defaults := loadSaved(t, `{"ip": "ssh.test", "port": 22, "connect_attempts": "three", "use_agent": "yes", "username": "user"}`)
+	if loaded.IP != "ssh.test" || loaded.Username != "user" {
+		t.Errorf("IP, Username = %q, %q, want the well-typed values kept", loaded.IP, loaded.Username)
+	}
+	if loaded.Port != defaults.Port || loaded.ConnectAttempts != defaults.ConnectAttempts || loaded.UseAgent != defaults.UseAgent {
+		t.Errorf("Port, ConnectAttempts, UseAgent = %q, %d, %v, want the defaults", loaded.Port, loaded.ConnectAttempts, loaded.UseAgent)
+	}
+}
+
+func TestUnmarshalInvalidValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		saved string
+		check func(loaded, defaults HiddifyExtensionSimpleSshData) bool
+	}{
+		{"mode", `{"mode": "bogus"}`, func(l, d HiddifyExtensionSimpleSshData) bool { return l.Mode == d.Mode }},
+		{"trust policy", `{"trust_policy": "always"}`, func(l, d HiddifyExtensionSimpleSshData) bool { return l.TrustPolicy == d.TrustPolicy }},
+		{"dscp", `{"dscp": 99}`, func(l, d HiddifyExtensionSimpleSshData) bool { return l.DSCP == d.DSCP }},
+		{"connect timeouts", `{"connect_timeout": 60, "connect_timeout_max": 10}`, func(l, d HiddifyExtensionSimpleSshData) bool {
+			return l.ConnectTimeout == d.ConnectTimeout && l.ConnectTimeoutMax == d.ConnectTimeoutMax
+		}},
+		{"agent forwarding", `{"forward_agent": true, "use_agent": false}`, func(l, d HiddifyExtensionSimpleSshData) bool { return !l.ForwardAgent }},
+		{"upstream without split tunnel", `{"upstream_outbound": "vpn"}`, func(l, d HiddifyExtensionSimpleSshData) bool { return l.UpstreamOutbound == "" }},
+		{"upstream with split tunnel", `{"upstream_outbound": "vpn", "split_tunnel_rules": "domain:example.com"}`, func(l, d HiddifyExtensionSimpleSshData) bool { return l.UpstreamOutbound == "vpn" }},
+		{"valid value kept", `{"mode": "shell"}`, func(l, d HiddifyExtensionSimpleSshData) bool { return l.Mode == ModeShell }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded, defaults := loadSaved(t, tt.saved)
+			if !tt.check(loaded, defaults) {
+				t.Errorf("loading %s gave %+v", tt.saved, loaded)
+			}
+		})
+	}
+}
+
+func TestUnmarshalForcedBootstrap(t *testing.T) {
+	t.Setenv(configEnv, `{"ip": "provisioned.test"}`)
+	loaded, _ := loadSaved(t, `{"ip": "saved.test", "username": "user"}`)
+	if loaded.IP != "saved.test" {
+		t.Errorf("IP = %q, want saved settings to take precedence", loaded.IP)
+	}
+
+	t.Setenv(configForceEnv, "true")
+	loaded, _ = loadSaved(t, `{"ip": "saved.test", "username": "user"}`)
+	if loaded.IP != "provisioned.test" || loaded.Username != "user" {
+		t.Errorf("IP, Username = %q, %q, want the provisioned IP forced over the saved settings", loaded.IP, loaded.Username)
+	}
+}
+
+func TestUnmarshalPercentSigns(t *testing.T) {
+	loaded, _ := loadSaved(t, `{"command": "date +%s; echo 100%", "post_connect_steps": "echo %h", "diagnostic_commands": "uptime"}`)
+	if loaded.Command != "date +%%s; echo 100%%" {
+		t.Errorf("Command = %q, want the percent signs of a command saved before tokens escaped", loaded.Command)
+	}
+	if loaded.PostConnectSteps != "echo %h" || loaded.DiagnosticCommands != "uptime" {
+		t.Errorf("PostConnectSteps, DiagnosticCommands = %q, %q, want commands with valid tokens kept", loaded.PostConnectSteps, loaded.DiagnosticCommands)
+	}
+	if got, err := expandTokens(loaded.Command, nil); err != nil || got != "date +%s; echo 100%" {
+		t.Errorf("expandTokens() = %q, %v, want the command as it was saved", got, err)
+	}
+}
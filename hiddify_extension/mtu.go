@@ -0,0 +1,108 @@
+package hiddify_extension
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Default MTU probe settings
+const (
+	defaultMTUProbeMin = 512
+	defaultMTUProbeMax = 65536
+	mtuProbeTimeout    = 5 * time.Second
+)
+
+// validateMTUProbe checks the MTU probe target and size range
+func validateMTUProbe(data HiddifyExtensionSimpleSshData) error {
+	if !data.MTUProbe {
+		return nil
+	}
+	if _, port, err := net.SplitHostPort(data.MTUProbeTarget); err != nil || port == "" {
+		return invalidField(MTUProbeTargetKey, fmt.Errorf("MTU probe target must be in host:port form"))
+	}
+	if data.MTUProbeMin < 1 || data.MTUProbeMax < data.MTUProbeMin {
+		return invalidField(MTUProbeMaxKey, fmt.Errorf("MTU probe sizes must satisfy 1 <= min <= max"))
+	}
+	return nil
+}
+
+// mtuProbeSizes returns the payload sizes to probe, doubling from min and ending at max
+func mtuProbeSizes(minSize int, maxSize int) []int {
+	var sizes []int
+	for size := minSize; size < maxSize; size *= 2 {
+		sizes = append(sizes, size)
+	}
+	return append(sizes, maxSize)
+}
+
+// probeMTU sends increasingly large payloads to an echo service through the tunnel
+// and reports the largest one that came back intact
+func (e *HiddifyExtensionSimpleSsh) probeMTU(ctx context.Context, client *ssh.Client) {
+	data := e.data()
+	target := data.MTUProbeTarget
+	e.addAndUpdateConsole(yellow.Sprint("MTU probe: "), "sending payloads to echo service "+target)
+
+	largest := 0
+	for _, size := range mtuProbeSizes(data.MTUProbeMin, data.MTUProbeMax) {
+		if err := e.echoPayload(ctx, client, target, size); err != nil {
+			e.addAndUpdateConsole(yellow.Sprintf("MTU probe: %d bytes failed: ", size), err.Error())
+			break
+		}
+		largest = size
+	}
+
+	if largest == 0 {
+		e.addAndUpdateConsole(red.Sprint("MTU probe: "), "no payload size succeeded")
+		return
+	}
+	e.addAndUpdateConsole(green.Sprint("MTU probe: "), "largest successful payload is "+strconv.Itoa(largest)+" bytes")
+}
+
+// echoPayload sends a random payload to an echo service and verifies the response
+func (e *HiddifyExtensionSimpleSsh) echoPayload(ctx context.Context, client *ssh.Client, target string, size int) error {
+	conn, err := client.Dial("tcp", target)
+	if err != nil {
+		return err
+	}
+	conn = e.traceConn(conn, "tunnel", target)
+	defer conn.Close()
+
+	payload := make([]byte, size)
+	rand.Read(payload)
+
+	// SSH channels do not support deadlines, so time the exchange out manually
+	done := make(chan error, 1)
+	go func() {
+		if _, err := conn.Write(payload); err != nil {
+			done <- err
+			return
+		}
+		echo := make([]byte, size)
+		if _, err := io.ReadFull(conn, echo); err != nil {
+			done <- err
+			return
+		}
+		if !bytes.Equal(echo, payload) {
+			done <- fmt.Errorf("echoed payload does not match")
+			return
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(mtuProbeTimeout):
+		return fmt.Errorf("no echo within %v", mtuProbeTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,107 @@
+package hiddify_extension
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+// Placeholder shown instead of credentials
+const redacted = "<redacted>"
+
+// Tag of the sing-box SSH outbound
+const outboundTag = "ssh-out"
+
+// singBoxOutbound builds a sing-box SSH outbound for the current settings. Credentials are
+// replaced by a placeholder when redact is set.
+func (e *HiddifyExtensionSimpleSsh) singBoxOutbound(redact bool) (option.Outbound, error) {
+	data := e.data()
+	port, err := strconv.ParseUint(data.Port, 10, 16)
+	if err != nil {
+		return option.Outbound{}, fmt.Errorf("invalid port %q", data.Port)
+	}
+	algorithms, err := resolveAlgorithms(data)
+	if err != nil {
+		return option.Outbound{}, err
+	}
+
+	ssh := option.SSHOutboundOptions{
+		ServerOptions:     option.ServerOptions{Server: data.IP, ServerPort: uint16(port)},
+		User:              data.Username,
+		HostKeyAlgorithms: algorithms.hostKeys,
+	}
+	ssh.Detour = data.UpstreamOutbound // Chains the connection through another outbound
+	secret := func(value string) string {
+		if redact {
+			return redacted
+		}
+		return value
+	}
+	if data.Password != "" {
+		ssh.Password = secret(data.Password)
+	}
+	for _, line := range strings.Split(data.HostKeys, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "SHA256:") {
+			ssh.HostKey = append(ssh.HostKey, line) // sing-box only takes full keys
+		}
+	}
+	if strings.TrimSpace(data.PrivateKey) != "" {
+		for _, key := range splitPrivateKeys(data.PrivateKey) {
+			ssh.PrivateKey = append(ssh.PrivateKey, secret(key))
+		}
+		if data.Passphrase != "" {
+			ssh.PrivateKeyPassphrase = secret(data.Passphrase)
+		}
+	}
+	return option.Outbound{Type: C.TypeSSH, Tag: outboundTag, SSHOptions: ssh}, nil
+}
+
+// showOutboundJSON shows the sing-box outbound for the current settings
+func (e *HiddifyExtensionSimpleSsh) showOutboundJSON() {
+	outbound, err := e.singBoxOutbound(true)
+	if err != nil {
+		e.ShowMessage("Cannot build outbound", err.Error())
+		return
+	}
+	var content strings.Builder
+	encoder := json.NewEncoder(&content)
+	encoder.SetEscapeHTML(false) // Keep the placeholders readable
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(&outbound); err != nil {
+		e.ShowMessage("Cannot build outbound", err.Error())
+		return
+	}
+
+	message := strings.TrimSpace(content.String())
+	if notes := e.outboundNotes(); len(notes) > 0 {
+		message += "\n\nNote: " + strings.Join(notes, "; ")
+	}
+	e.ShowMessage("sing-box Outbound", message)
+}
+
+// outboundNotes points out settings the sing-box outbound cannot express
+func (e *HiddifyExtensionSimpleSsh) outboundNotes() []string {
+	data := e.data()
+	var notes []string
+	if data.Transport != TransportTCP {
+		notes = append(notes, "the "+data.Transport+" transport is not supported by sing-box SSH outbounds")
+	}
+	if data.JumpHosts != "" {
+		notes = append(notes, "jump hosts must be added as separate outbounds chained with \"detour\"")
+	}
+	if data.UpstreamOutbound != "" {
+		notes = append(notes, "only the sing-box outbound dials through "+strconv.Quote(data.UpstreamOutbound)+", the extension's own connection dials the server directly")
+	}
+	if data.UseAgent {
+		notes = append(notes, "sing-box cannot use the SSH agent, paste the key instead")
+	}
+	if algorithms, err := resolveAlgorithms(data); err == nil && (algorithms.ciphers != nil || algorithms.keyExchanges != nil || algorithms.macs != nil) {
+		notes = append(notes, "sing-box cannot restrict ciphers, key exchanges or MACs, only host key algorithms are kept")
+	}
+	return notes
+}
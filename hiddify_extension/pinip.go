@@ -0,0 +1,53 @@
+package hiddify_extension
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// pinnedIP is the address the server host name resolved to, kept while pinning is enabled
+type pinnedIP struct {
+	mu   sync.Mutex
+	host string // Host name the IP was resolved from
+	ip   string // Resolved IP
+}
+
+// pinnedDialAddress replaces the server host name in address with its pinned IP, resolving and
+// pinning it on first use, so retries and reconnects cannot be sent elsewhere by a changed DNS
+// answer. Other addresses, such as jump hosts, and literal IPs are returned unchanged.
+func (e *HiddifyExtensionSimpleSsh) pinnedDialAddress(ctx context.Context, resolver *net.Resolver, address string) (string, error) {
+	data := e.data()
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || !data.PinResolvedIP || host != data.IP || net.ParseIP(host) != nil {
+		return address, nil
+	}
+
+	e.pinned.mu.Lock()
+	defer e.pinned.mu.Unlock()
+	if e.pinned.host != host {
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		ips, err := resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return "", err
+		}
+		if len(ips) == 0 {
+			return "", fmt.Errorf("no addresses found for %s", host)
+		}
+		e.pinned.host, e.pinned.ip = host, ips[0].IP.String()
+		e.addAndUpdateConsole(green.Sprint("Pinned IP: "), fmt.Sprintf("%s resolved to %s, kept until the next connect", host, e.pinned.ip))
+	} else {
+		e.addAndUpdateConsole(yellow.Sprint("Using pinned IP: "), e.pinned.ip+" for "+host)
+	}
+	return net.JoinHostPort(e.pinned.ip, port), nil
+}
+
+// clearPinnedIP forgets the pinned IP, so the next connection resolves the host name again
+func (e *HiddifyExtensionSimpleSsh) clearPinnedIP() {
+	e.pinned.mu.Lock()
+	defer e.pinned.mu.Unlock()
+	e.pinned.host, e.pinned.ip = "", ""
+}
@@ -0,0 +1,67 @@
+package hiddify_extension
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPinnedIPReusedOnReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	var dns fakeDNS
+	dns.set("A ssh.test.", "127.0.0.1")
+	e := NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh)
+	e.Base.Data.IP = "ssh.test"
+	e.Base.Data.PinResolvedIP = true
+	ctx := context.WithValue(context.Background(), resolverKey{}, dns.resolver())
+	dial := func() error {
+		conn, err := e.dialTransport(ctx, net.JoinHostPort("ssh.test", port), 5*time.Second)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	if err := dial(); err != nil {
+		t.Fatalf("first dial error = %v", err)
+	}
+	queries := dns.queries.Load()
+	if queries == 0 {
+		t.Fatal("the first dial did not resolve the server")
+	}
+
+	// A changed answer must not redirect the reconnect
+	dns.set("A ssh.test.", "192.0.2.1")
+	if err := dial(); err != nil {
+		t.Fatalf("reconnect error = %v, want the pinned IP dialed", err)
+	}
+	if got := dns.queries.Load(); got != queries {
+		t.Errorf("reconnect sent %d DNS queries, want the pinned IP reused", got-queries)
+	}
+
+	// An explicit connect resolves again
+	e.clearPinnedIP()
+	dns.set("A ssh.test.", "127.0.0.1")
+	if err := dial(); err != nil {
+		t.Fatalf("dial after clearing the pin error = %v", err)
+	}
+	if got := dns.queries.Load(); got == queries {
+		t.Error("the cleared pin was reused without resolving")
+	}
+}
@@ -0,0 +1,54 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// parsePort checks that a port is a number between 1 and 65535
+func parsePort(value string) (string, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || port < 1 || port > 65535 {
+		return "", fmt.Errorf("invalid port %q, must be between 1 and 65535", strings.TrimSpace(value))
+	}
+	return strconv.Itoa(port), nil
+}
+
+// parseFallbackPorts parses a comma-separated list of ports, dropping duplicates
+func parseFallbackPorts(value string) ([]string, error) {
+	var ports []string
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		port, err := parsePort(entry)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(ports, port) {
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+// candidatePorts returns the ports to try in order: the configured port, then the fallback
+// ports, with the port of the last successful connection moved to the front
+func (e *HiddifyExtensionSimpleSsh) candidatePorts() []string {
+	data := e.data()
+	ports := []string{data.Port}
+	fallbacks, _ := parseFallbackPorts(data.FallbackPorts) // Validated when set
+	for _, port := range fallbacks {
+		if !slices.Contains(ports, port) {
+			ports = append(ports, port)
+		}
+	}
+	if working, _ := e.workingPort.Load().(string); working != "" {
+		if idx := slices.Index(ports, working); idx > 0 {
+			ports = append([]string{working}, slices.Delete(ports, idx, idx+1)...)
+		}
+	}
+	return ports
+}
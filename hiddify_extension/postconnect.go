@@ -0,0 +1,76 @@
+package hiddify_extension
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Maximum time allowed for all post-connect steps together
+const postConnectTimeout = 2 * time.Minute
+
+// runPostConnect runs the post-connect steps in order, reporting each step's exit code. It returns
+// false when a step failed and the remaining work must be aborted.
+func (e *HiddifyExtensionSimpleSsh) runPostConnect(ctx context.Context, client *ssh.Client) bool {
+	data := e.data()
+	steps := splitLines(data.PostConnectSteps)
+	if len(steps) == 0 {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, postConnectTimeout)
+	defer cancel()
+
+	tokens := e.commandTokens()
+	failed := 0
+	for i, step := range steps {
+		label := fmt.Sprintf("Step %d of %d ", i+1, len(steps))
+		command, err := expandTokens(step, tokens)
+		if err != nil {
+			e.addAndUpdateConsole(red.Sprint(label+"skipped: "), err.Error())
+			return false
+		}
+
+		output, err := runCommand(ctx, client, command)
+		code := exitCode(err)
+		text := strings.TrimRight(sanitizeText(string(output)), "\n")
+		switch {
+		case err == nil:
+			e.addAndUpdateConsole(green.Sprintf("%s%q: exit 0\n", label, command), text)
+			continue
+		case errors.Is(err, context.DeadlineExceeded):
+			e.addAndUpdateConsole(red.Sprintf("%s%q: ", label, command), fmt.Sprintf("steps did not finish within %v", postConnectTimeout))
+			return false
+		case code >= 0:
+			e.addAndUpdateConsole(red.Sprintf("%s%q: exit %d\n", label, command, code), text)
+		default:
+			e.addAndUpdateConsole(red.Sprintf("%s%q failed: ", label, command), sanitizeText(err.Error()))
+		}
+
+		failed++
+		if data.AbortOnStepFailure {
+			e.addAndUpdateConsole(red.Sprint("Post-connect steps aborted: "), fmt.Sprintf("%d of %d steps were not run", len(steps)-i-1, len(steps)))
+			return false
+		}
+	}
+	if failed > 0 {
+		e.addAndUpdateConsole(yellow.Sprint("Post-connect steps finished: "), fmt.Sprintf("%d of %d failed", failed, len(steps)))
+	}
+	return true
+}
+
+// exitCode returns the remote exit status of a command error, 0 for success or -1 when unknown
+func exitCode(err error) int {
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.ExitStatus()
+	default:
+		return -1
+	}
+}
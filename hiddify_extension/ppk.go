@@ -0,0 +1,319 @@
+package hiddify_extension
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+// PuTTY private key file header prefix
+const ppkHeaderPrefix = "PuTTY-User-Key-File-"
+
+// ppkFile holds the decoded sections of a PuTTY private key file
+type ppkFile struct {
+	version    int
+	algorithm  string
+	encryption string
+	comment    string
+	public     []byte
+	private    []byte
+	mac        []byte
+	headers    map[string]string
+}
+
+// isPPK reports whether the key data is in PuTTY .ppk format
+func isPPK(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ppkHeaderPrefix))
+}
+
+// parsePPK converts a PuTTY v2 or v3 private key into an SSH signer
+func parsePPK(data []byte, passphrase []byte) (ssh.Signer, error) {
+	file, err := decodePPK(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var encrypted bool
+	switch file.encryption {
+	case "none":
+	case "aes256-cbc":
+		encrypted = true
+		if len(passphrase) == 0 {
+			return nil, errors.New("key is encrypted, please enter its passphrase")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encryption %q", file.encryption)
+	}
+
+	// Derive the cipher and MAC keys for the file version
+	var cipherKey, iv, macKey []byte
+	var newHash func() hash.Hash
+	switch file.version {
+	case 2:
+		var macPassphrase []byte
+		if encrypted {
+			cipherKey = ppkV2CipherKey(passphrase)
+			iv = make([]byte, aes.BlockSize)
+			macPassphrase = passphrase
+		}
+		mac := sha1.Sum(append([]byte("putty-private-key-file-mac-key"), macPassphrase...))
+		macKey = mac[:]
+		newHash = sha1.New
+	case 3:
+		if encrypted {
+			derived, err := ppkV3DeriveKeys(file.headers, passphrase)
+			if err != nil {
+				return nil, err
+			}
+			cipherKey, iv, macKey = derived[:32], derived[32:48], derived[48:]
+		}
+		newHash = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported PPK version %d", file.version)
+	}
+
+	// Decrypt the private section
+	private := file.private
+	if encrypted {
+		if len(private)%aes.BlockSize != 0 {
+			return nil, errors.New("private section is not a multiple of the cipher block size")
+		}
+		block, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			return nil, err
+		}
+		private = make([]byte, len(file.private))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(private, file.private)
+	}
+
+	// Verify the MAC over the key contents
+	mac := hmac.New(newHash, macKey)
+	for _, field := range [][]byte{[]byte(file.algorithm), []byte(file.encryption), []byte(file.comment), file.public, private} {
+		mac.Write(ssh.Marshal(struct{ Data []byte }{field}))
+	}
+	if !hmac.Equal(mac.Sum(nil), file.mac) {
+		if encrypted {
+			return nil, errors.New("wrong passphrase or corrupted key")
+		}
+		return nil, errors.New("key MAC verification failed, the file may be corrupted")
+	}
+
+	key, err := ppkPrivateKey(file.algorithm, file.public, private)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewSignerFromKey(key)
+}
+
+// decodePPK splits a PuTTY key file into its headers and base64 sections
+func decodePPK(text string) (*ppkFile, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	file := &ppkFile{headers: make(map[string]string)}
+
+	for i := 0; i < len(lines); i++ {
+		name, value, ok := strings.Cut(lines[i], ": ")
+		if !ok {
+			if strings.TrimSpace(lines[i]) == "" {
+				continue
+			}
+			return nil, fmt.Errorf("malformed line %d", i+1)
+		}
+		value = strings.TrimSpace(value)
+
+		switch {
+		case strings.HasPrefix(name, ppkHeaderPrefix):
+			version, err := strconv.Atoi(strings.TrimPrefix(name, ppkHeaderPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("invalid PPK version %q", name)
+			}
+			file.version = version
+			file.algorithm = value
+		case name == "Public-Lines" || name == "Private-Lines":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 0 || i+count >= len(lines) {
+				return nil, fmt.Errorf("invalid %s value %q", name, value)
+			}
+			blob, err := base64.StdEncoding.DecodeString(strings.Join(lines[i+1:i+1+count], ""))
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 in %s section: %w", strings.TrimSuffix(name, "-Lines"), err)
+			}
+			if name == "Public-Lines" {
+				file.public = blob
+			} else {
+				file.private = blob
+			}
+			i += count
+		case name == "Private-MAC":
+			mac, err := hex.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Private-MAC: %w", err)
+			}
+			file.mac = mac
+		case name == "Encryption":
+			file.encryption = value
+		case name == "Comment":
+			file.comment = value
+		default:
+			file.headers[name] = value
+		}
+	}
+
+	if file.algorithm == "" || file.public == nil || file.private == nil || file.mac == nil {
+		return nil, errors.New("incomplete PPK file")
+	}
+	return file, nil
+}
+
+// ppkV2CipherKey derives the AES-256 key used by PPK version 2 files
+func ppkV2CipherKey(passphrase []byte) []byte {
+	var key []byte
+	for seq := uint32(0); seq < 2; seq++ {
+		h := sha1.New()
+		binary.Write(h, binary.BigEndian, seq)
+		h.Write(passphrase)
+		key = h.Sum(key)
+	}
+	return key[:32]
+}
+
+// ppkV3DeriveKeys derives the AES key, IV and MAC key of PPK version 3 files using Argon2
+func ppkV3DeriveKeys(headers map[string]string, passphrase []byte) ([]byte, error) {
+	params := make(map[string]uint32)
+	for _, name := range []string{"Argon2-Memory", "Argon2-Passes", "Argon2-Parallelism"} {
+		val, err := strconv.ParseUint(headers[name], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q", name, headers[name])
+		}
+		params[name] = uint32(val)
+	}
+	if params["Argon2-Parallelism"] == 0 || params["Argon2-Parallelism"] > 255 {
+		return nil, fmt.Errorf("unsupported Argon2-Parallelism %d", params["Argon2-Parallelism"])
+	}
+	salt, err := hex.DecodeString(headers["Argon2-Salt"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Argon2-Salt: %w", err)
+	}
+
+	memory, passes, threads := params["Argon2-Memory"], params["Argon2-Passes"], uint8(params["Argon2-Parallelism"])
+	switch headers["Key-Derivation"] {
+	case "Argon2id":
+		return argon2.IDKey(passphrase, salt, passes, memory, threads, 80), nil
+	case "Argon2i":
+		return argon2.Key(passphrase, salt, passes, memory, threads, 80), nil
+	default:
+		return nil, fmt.Errorf("unsupported key derivation %q", headers["Key-Derivation"])
+	}
+}
+
+// ppkPrivateKey builds a crypto private key from the PPK public and private blobs
+func ppkPrivateKey(algorithm string, public []byte, private []byte) (any, error) {
+	pub, err := ssh.ParsePublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if pub.Type() != algorithm {
+		return nil, fmt.Errorf("key type %q does not match header %q", pub.Type(), algorithm)
+	}
+	cryptoKey, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported PPK key type %q", algorithm)
+	}
+	cryptoPub := cryptoKey.CryptoPublicKey()
+	r := &sshWireReader{buf: private}
+
+	switch pk := cryptoPub.(type) {
+	case *rsa.PublicKey:
+		d, p, q := r.mpint(), r.mpint(), r.mpint()
+		r.mpint() // iqmp is recomputed by Precompute
+		if r.err != nil {
+			return nil, r.err
+		}
+		key := &rsa.PrivateKey{PublicKey: *pk, D: d, Primes: []*big.Int{p, q}}
+		key.Precompute()
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid RSA key: %w", err)
+		}
+		return key, nil
+	case *ecdsa.PublicKey:
+		d := r.mpint()
+		if r.err != nil {
+			return nil, r.err
+		}
+		key := &ecdsa.PrivateKey{PublicKey: *pk, D: d}
+		private, err := key.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("invalid ECDSA key: %w", err)
+		}
+		public, err := pk.ECDH()
+		if err != nil || !private.PublicKey().Equal(public) {
+			return nil, errors.New("ECDSA private key does not match public key")
+		}
+		return key, nil
+	case ed25519.PublicKey:
+		seed := r.string()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if len(seed) > ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid ed25519 private key length %d", len(seed))
+		}
+		// PuTTY writes the seed as a little-endian integer without its high zero bytes
+		padded := make([]byte, ed25519.SeedSize)
+		copy(padded, seed)
+		key := ed25519.NewKeyFromSeed(padded)
+		if !bytes.Equal(key.Public().(ed25519.PublicKey), pk) {
+			return nil, errors.New("ed25519 private key does not match public key")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported PPK key type %q", algorithm)
+	}
+}
+
+// sshWireReader reads SSH wire-format strings and integers from a buffer
+type sshWireReader struct {
+	buf []byte
+	err error
+}
+
+// string reads a length-prefixed byte string
+func (r *sshWireReader) string() []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf) < 4 {
+		r.err = errors.New("truncated private key data")
+		return nil
+	}
+	n := binary.BigEndian.Uint32(r.buf)
+	if uint64(n) > uint64(len(r.buf)-4) {
+		r.err = errors.New("truncated private key data")
+		return nil
+	}
+	data := r.buf[4 : 4+n]
+	r.buf = r.buf[4+n:]
+	return data
+}
+
+// mpint reads a non-negative multiple precision integer
+func (r *sshWireReader) mpint() *big.Int {
+	return new(big.Int).SetBytes(r.string())
+}
@@ -0,0 +1,218 @@
+package hiddify_extension
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestPPKPrivateKey(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edPub, _ := ssh.NewPublicKey(edKey.Public())
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecPub, _ := ssh.NewPublicKey(&ecKey.PublicKey)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	signer, _ := ssh.NewSignerFromKey(edKey)
+	cert := &ssh.Certificate{Key: edPub, CertType: ssh.UserCert}
+	if err := cert.SignCert(rand.Reader, signer); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		algorithm string
+		public    []byte
+		private   []byte
+		wantErr   bool
+	}{
+		{"ed25519", ssh.KeyAlgoED25519, edPub.Marshal(), ssh.Marshal(struct{ Seed []byte }{edKey.Seed()}), false},
+		{"ecdsa", ssh.KeyAlgoECDSA256, ecPub.Marshal(), ssh.Marshal(struct{ D []byte }{ecKey.D.Bytes()}), false},
+		{"ecdsa mismatch", ssh.KeyAlgoECDSA256, ecPub.Marshal(), ssh.Marshal(struct{ D []byte }{otherKey.D.Bytes()}), true},
+		{"ecdsa zero scalar", ssh.KeyAlgoECDSA256, ecPub.Marshal(), ssh.Marshal(struct{ D []byte }{nil}), true},
+		{"certificate", cert.Type(), cert.Marshal(), ssh.Marshal(struct{ Seed []byte }{edKey.Seed()}), true},
+		{"truncated", ssh.KeyAlgoED25519, edPub.Marshal(), []byte{0, 0}, true},
+		{"type mismatch", ssh.KeyAlgoRSA, edPub.Marshal(), ssh.Marshal(struct{ Seed []byte }{edKey.Seed()}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ppkPrivateKey(tt.algorithm, tt.public, tt.private)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ppkPrivateKey() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// encodePPK writes a PuTTY key file of the given version as PuTTYgen does, encrypted when
+// passphrase is set. Version 3 files use cheap Argon2 parameters to keep the tests fast.
+func encodePPK(t *testing.T, version int, public ssh.PublicKey, private []byte, passphrase string) string {
+	t.Helper()
+	encryption, comment := "none", "test key"
+	var cipherKey, iv, macKey, salt []byte
+	newHash := sha256.New
+	switch {
+	case version == 2:
+		newHash = sha1.New
+		for seq := byte(0); seq < 2 && passphrase != ""; seq++ {
+			h := sha1.Sum(append([]byte{0, 0, 0, seq}, passphrase...))
+			cipherKey = append(cipherKey, h[:]...)
+		}
+		if passphrase != "" {
+			cipherKey, iv = cipherKey[:32], make([]byte, aes.BlockSize)
+		}
+		mac := sha1.Sum([]byte("putty-private-key-file-mac-key" + passphrase))
+		macKey = mac[:]
+	case passphrase != "":
+		salt = make([]byte, 16)
+		rand.Read(salt)
+		derived := argon2.IDKey([]byte(passphrase), salt, 1, 8, 1, 80)
+		cipherKey, iv, macKey = derived[:32], derived[32:48], derived[48:]
+	}
+
+	if passphrase != "" {
+		encryption = "aes256-cbc"
+		private = append(private, make([]byte, aes.BlockSize-len(private)%aes.BlockSize)...)
+	}
+	mac := hmac.New(newHash, macKey)
+	for _, field := range [][]byte{[]byte(public.Type()), []byte(encryption), []byte(comment), public.Marshal(), private} {
+		mac.Write(ssh.Marshal(struct{ Data []byte }{field}))
+	}
+	if passphrase != "" {
+		block, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted := make([]byte, len(private))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, private)
+		private = encrypted
+	}
+
+	lines := func(blob []byte) string {
+		text := base64.StdEncoding.EncodeToString(blob)
+		var out []string
+		for len(text) > 64 {
+			out, text = append(out, text[:64]), text[64:]
+		}
+		out = append(out, text)
+		return fmt.Sprintf("%d\n%s\n", len(out), strings.Join(out, "\n"))
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "PuTTY-User-Key-File-%d: %s\nEncryption: %s\nComment: %s\n", version, public.Type(), encryption, comment)
+	sb.WriteString("Public-Lines: " + lines(public.Marshal()))
+	if salt != nil {
+		fmt.Fprintf(&sb, "Key-Derivation: Argon2id\nArgon2-Memory: 8\nArgon2-Passes: 1\nArgon2-Parallelism: 1\nArgon2-Salt: %x\n", salt)
+	}
+	sb.WriteString("Private-Lines: " + lines(private))
+	fmt.Fprintf(&sb, "Private-MAC: %s\n", hex.EncodeToString(mac.Sum(nil)))
+	return sb.String()
+}
+
+func TestParsePPK(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// One seed in 256 ends in a zero byte, which PuTTY leaves out
+	shortSeed := make([]byte, ed25519.SeedSize)
+	rand.Read(shortSeed[:ed25519.SeedSize-1])
+	shortKey := ed25519.NewKeyFromSeed(shortSeed)
+
+	mpints := func(values ...*big.Int) []byte {
+		var blob []byte
+		for _, v := range values {
+			blob = append(blob, ssh.Marshal(struct{ V *big.Int }{v})...)
+		}
+		return blob
+	}
+	keys := []struct {
+		name    string
+		key     any
+		private []byte
+	}{
+		{"ed25519", edKey, ssh.Marshal(struct{ Seed []byte }{edKey.Seed()})},
+		{"ed25519 short seed", shortKey, ssh.Marshal(struct{ Seed []byte }{shortSeed[:ed25519.SeedSize-1]})},
+		{"rsa", rsaKey, mpints(rsaKey.D, rsaKey.Primes[0], rsaKey.Primes[1], rsaKey.Precomputed.Qinv)},
+		{"ecdsa", ecKey, mpints(ecKey.D)},
+	}
+	for _, version := range []int{2, 3} {
+		for _, k := range keys {
+			for _, passphrase := range []string{"", "passphrase"} {
+				name := fmt.Sprintf("v%d %s", version, k.name)
+				if passphrase != "" {
+					name += " encrypted"
+				}
+				t.Run(name, func(t *testing.T) {
+					signer, err := ssh.NewSignerFromKey(k.key)
+					if err != nil {
+						t.Fatal(err)
+					}
+					file := encodePPK(t, version, signer.PublicKey(), k.private, passphrase)
+
+					parsed, err := parsePPK([]byte(file), []byte(passphrase))
+					if err != nil {
+						t.Fatalf("parsePPK() error = %v", err)
+					}
+					if !bytes.Equal(parsed.PublicKey().Marshal(), signer.PublicKey().Marshal()) {
+						t.Error("parsePPK() returned a different key")
+					}
+					if passphrase == "" {
+						return
+					}
+					if _, err := parsePPK([]byte(file), []byte("wrong")); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+						t.Errorf("parsePPK() with a wrong passphrase error = %v, want a wrong passphrase error", err)
+					}
+					if _, err := parsePPK([]byte(file), nil); err == nil || !strings.Contains(err.Error(), "enter its passphrase") {
+						t.Errorf("parsePPK() without a passphrase error = %v, want a request for it", err)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestParsePPKCorrupted(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(key)
+	file := encodePPK(t, 3, signer.PublicKey(), ssh.Marshal(struct{ Seed []byte }{key.Seed()}), "")
+
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{"comment changed", strings.Replace(file, "Comment: test key", "Comment: other key", 1), "MAC verification failed"},
+		{"version", strings.Replace(file, "PuTTY-User-Key-File-3", "PuTTY-User-Key-File-4", 1), "unsupported PPK version 4"},
+		{"encryption", strings.Replace(file, "Encryption: none", "Encryption: aes128-cbc", 1), "unsupported encryption"},
+		{"no MAC", file[:strings.Index(file, "Private-MAC")], "incomplete PPK file"},
+		{"line count", strings.Replace(file, "Public-Lines: 2", "Public-Lines: 99", 1), "invalid Public-Lines"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parsePPK([]byte(tt.file), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parsePPK() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package hiddify_extension
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Time allowed for the preflight port check
+const preflightTimeout = 3 * time.Second
+
+// checkPort does a plain TCP connect to the SSH port and reports whether it is open,
+// closed or filtered before the slower SSH handshake is attempted. Failures are returned
+// to the caller, which reports them as connection errors.
+func (e *HiddifyExtensionSimpleSsh) checkPort(ctx context.Context, dialer proxyDialer, address string) error {
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		var dnsErr *net.DNSError
+		var netErr net.Error
+		switch {
+		case errors.As(err, &dnsErr):
+			err = fmt.Errorf("%s could not be resolved: %w", address, err)
+		case errors.Is(err, syscall.ECONNREFUSED):
+			err = fmt.Errorf("%s is closed (connection refused)", address)
+		case errors.As(err, &netErr) && netErr.Timeout():
+			err = fmt.Errorf("%s is filtered (no response within %v)", address, preflightTimeout)
+		default:
+			err = fmt.Errorf("%s is unreachable: %w", address, err)
+		}
+		return fmt.Errorf("port check: %w", err)
+	}
+	conn.Close()
+
+	e.addAndUpdateConsole(green.Sprint("Port check: "), fmt.Sprintf("%s is open (RTT %v)", address, time.Since(start).Round(time.Millisecond)))
+	return nil
+}
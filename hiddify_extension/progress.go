@@ -0,0 +1,81 @@
+package hiddify_extension
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Spinner animation shown while connecting
+var (
+	spinnerFrames   = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+	spinnerInterval = 250 * time.Millisecond // Also limits how often the UI is refreshed
+)
+
+// startProgress shows an animated progress line until the returned function is called
+func (e *HiddifyExtensionSimpleSsh) startProgress(phase string) (done func()) {
+	e.progressMu.Lock()
+	e.progressPhase = phase
+	e.progressMu.Unlock()
+	e.UpdateUI(e.form())
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(spinnerInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				e.progressMu.Lock()
+				e.progressFrame = (e.progressFrame + 1) % len(spinnerFrames)
+				e.progressMu.Unlock()
+				e.UpdateUI(e.form())
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		e.setProgress("")
+	}
+}
+
+// setProgress changes the phase shown by the progress line; the spinner picks it up on its next frame
+func (e *HiddifyExtensionSimpleSsh) setProgress(phase string) {
+	e.progressMu.Lock()
+	defer e.progressMu.Unlock()
+	e.progressPhase = phase
+}
+
+// progressLine returns the progress line shown above the console output, if connecting
+func (e *HiddifyExtensionSimpleSsh) progressLine() string {
+	e.progressMu.Lock()
+	defer e.progressMu.Unlock()
+	if e.progressPhase == "" {
+		return ""
+	}
+	return yellow.Sprintf("%c %s...", spinnerFrames[e.progressFrame], e.progressPhase) + "\n"
+}
+
+// dialPhase names the phase that opens the connection to the server
+func dialPhase(host string) string {
+	if net.ParseIP(host) == nil {
+		return "Resolving and connecting"
+	}
+	return "Connecting"
+}
+
+// authProgress wraps a host key callback to report that authentication has started,
+// which follows the key exchange and host key verification
+func (e *HiddifyExtensionSimpleSsh) authProgress(callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := callback(hostname, remote, key); err != nil {
+			return err
+		}
+		e.setProgress("Authenticating to " + hostname)
+		return nil
+	}
+}
@@ -0,0 +1,31 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgressRendersWhileLogging(t *testing.T) {
+	e := NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh)
+	done := e.startProgress("Connecting")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ { // Outlasts a spinner frame
+				e.addAndUpdateConsole(fmt.Sprintf("line %d.%d", i, j))
+				time.Sleep(spinnerInterval / 25)
+			}
+		}(i)
+	}
+	wg.Wait()
+	done()
+
+	if count := strings.Count(e.consoleText(), "line "); count != 200 {
+		t.Errorf("console has %d lines, want 200", count)
+	}
+}
@@ -0,0 +1,146 @@
+package hiddify_extension
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// environmentProxy returns the proxy that HTTP_PROXY, HTTPS_PROXY and NO_PROXY select for
+// target, or nil for a direct connection, and logs the decision
+func (e *HiddifyExtensionSimpleSsh) environmentProxy(target *url.URL) (*url.URL, error) {
+	if !e.data().UseSystemProxy {
+		e.addAndUpdateConsole(yellow.Sprint("Proxy: "), "direct (environment ignored)")
+		return nil, nil
+	}
+	proxy, err := http.ProxyFromEnvironment(&http.Request{URL: target})
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("invalid proxy environment: %w", err)
+	case proxy == nil:
+		e.addAndUpdateConsole(yellow.Sprint("Proxy: "), "direct")
+	default:
+		e.addAndUpdateConsole(yellow.Sprint("Proxy: "), proxy.Redacted())
+	}
+	return proxy, nil
+}
+
+// proxyDialer opens TCP connections directly or through an HTTP CONNECT proxy
+type proxyDialer struct {
+	netDialer *net.Dialer
+	proxy     *url.URL // Proxy to tunnel through, nil for direct connections
+}
+
+// DialContext connects to address, tunneling through the proxy if one is set
+func (d proxyDialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	if d.proxy == nil {
+		return d.netDialer.DialContext(ctx, network, address)
+	}
+
+	var conn net.Conn
+	var err error
+	switch d.proxy.Scheme {
+	case "http":
+		conn, err = d.netDialer.DialContext(ctx, "tcp", proxyAddress(d.proxy, "80"))
+	case "https":
+		tlsDialer := tls.Dialer{NetDialer: d.netDialer, Config: &tls.Config{ServerName: d.proxy.Hostname()}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", proxyAddress(d.proxy, "443"))
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", d.proxy.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach proxy %s: %w", d.proxy.Redacted(), err)
+	}
+
+	// Bound the CONNECT exchange like the rest of the dial
+	if d.netDialer.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(d.netDialer.Timeout))
+	}
+	if err := proxyConnect(conn, d.proxy, address); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return tunneledConn{Conn: conn, target: address}, nil
+}
+
+// tunneledConn is a connection that reaches target through an intermediary such as a proxy. It
+// reports the target as its remote address, since the intermediary's says nothing about it.
+type tunneledConn struct {
+	net.Conn
+	target string // host:port that was dialed
+}
+
+// RemoteAddr returns the dialed target
+func (c tunneledConn) RemoteAddr() net.Addr {
+	return targetAddr(c.target)
+}
+
+// targetAddr returns the address of a dialed host:port, a *net.TCPAddr when the host is an IP
+func targetAddr(address string) net.Addr {
+	host, port, err := net.SplitHostPort(address)
+	if ip := net.ParseIP(host); err == nil && ip != nil {
+		portNumber, _ := strconv.Atoi(port)
+		return &net.TCPAddr{IP: ip, Port: portNumber}
+	}
+	return hostAddr(address)
+}
+
+// hostAddr is a host:port whose IP is not known
+type hostAddr string
+
+func (a hostAddr) Network() string { return "tcp" }
+func (a hostAddr) String() string  { return string(a) }
+
+// proxyAddress returns the host:port of a proxy URL
+func proxyAddress(proxy *url.URL, defaultPort string) string {
+	port := proxy.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	return net.JoinHostPort(proxy.Hostname(), port)
+}
+
+// proxyConnect asks the proxy to open a tunnel to address
+func proxyConnect(conn net.Conn, proxy *url.URL, address string) error {
+	request := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", address, address)
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		request += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+	if _, err := conn.Write([]byte(request + "\r\n")); err != nil {
+		return fmt.Errorf("proxy CONNECT failed: %w", err)
+	}
+
+	// Read byte by byte so nothing after the response headers is consumed
+	// and leave the body alone, it is the tunnel itself
+	response, err := http.ReadResponse(bufio.NewReaderSize(byteReader{conn}, 1), nil)
+	if err != nil {
+		return fmt.Errorf("proxy CONNECT failed: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy refused CONNECT to %s: %s", address, response.Status)
+	}
+	return nil
+}
+
+// byteReader reads at most one byte at a time
+type byteReader struct {
+	conn net.Conn
+}
+
+// Read reads a single byte
+func (r byteReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return r.conn.Read(p)
+}
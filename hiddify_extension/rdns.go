@@ -0,0 +1,71 @@
+package hiddify_extension
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Time allowed for a reverse lookup, so readable logs never hold up the connection for long
+const reverseDNSTimeout = 2 * time.Second
+
+// reverseNames caches reverse DNS names of remote addresses. Names are only displayed and never
+// used to connect.
+type reverseNames struct {
+	mu     sync.Mutex
+	names  map[string]string                                      // Name by IP, empty when the lookup found none
+	lookup func(ctx context.Context, ip string) ([]string, error) // Reverse lookup, nil for the system resolver
+}
+
+// name returns the cached or looked up name of ip, or an empty string when it has none
+func (r *reverseNames) name(ip string) string {
+	r.mu.Lock()
+	name, ok := r.names[ip]
+	lookup := r.lookup
+	r.mu.Unlock()
+	if ok {
+		return name
+	}
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupAddr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reverseDNSTimeout)
+	defer cancel()
+	names, err := lookup(ctx, ip)
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil && len(names) > 0:
+		name = strings.TrimSuffix(names[0], ".")
+	case err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound):
+		return "" // Not cached, the resolver may answer next time
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names == nil {
+		r.names = make(map[string]string)
+	}
+	r.names[ip] = name
+	return name
+}
+
+// displayAddress adds the reverse DNS name of remote to address when ReverseDNS is set and
+// the name differs from the configured host
+func (e *HiddifyExtensionSimpleSsh) displayAddress(address string, remote net.Addr) string {
+	if !e.data().ReverseDNS || remote == nil {
+		return address
+	}
+	ip, _, err := net.SplitHostPort(remote.String())
+	if err != nil || net.ParseIP(ip) == nil {
+		return address
+	}
+	name := e.reverseDNS.name(ip)
+	if host, _, _ := net.SplitHostPort(address); name == "" || strings.EqualFold(name, host) {
+		return address
+	}
+	return address + " (" + name + ")"
+}
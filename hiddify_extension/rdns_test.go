@@ -0,0 +1,77 @@
+package hiddify_extension
+
+import (
+	"net"
+	"testing"
+)
+
+func TestReverseNames(t *testing.T) {
+	var dns fakeDNS
+	dns.set("PTR 1.2.0.192.in-addr.arpa.", "host.example.")
+	names := reverseNames{lookup: dns.resolver().LookupAddr}
+
+	// Found names are cached without the trailing dot
+	for i := 0; i < 2; i++ {
+		if name := names.name("192.0.2.1"); name != "host.example" {
+			t.Errorf("name() = %q, want host.example", name)
+		}
+	}
+	if queries := dns.queries.Load(); queries != 1 {
+		t.Errorf("%d DNS queries for two lookups, want the name cached", queries)
+	}
+
+	// An address without a name is cached as such
+	for i := 0; i < 2; i++ {
+		if name := names.name("192.0.2.2"); name != "" {
+			t.Errorf("name() = %q for an address without a name, want none", name)
+		}
+	}
+	if queries := dns.queries.Load(); queries != 2 {
+		t.Errorf("%d DNS queries, want the missing name cached", queries)
+	}
+}
+
+func TestReverseNamesTimeout(t *testing.T) {
+	dns := &fakeDNS{hang: true}
+	dns.set("PTR 1.2.0.192.in-addr.arpa.", "host.example.")
+	names := reverseNames{lookup: dns.resolver().LookupAddr}
+	if name := names.name("192.0.2.1"); name != "" {
+		t.Errorf("name() = %q from a resolver that never answers, want none", name)
+	}
+
+	// A timeout is not cached, the resolver may answer next time
+	names.lookup = (&fakeDNS{records: dns.records}).resolver().LookupAddr
+	if name := names.name("192.0.2.1"); name != "host.example" {
+		t.Errorf("name() after a timeout = %q, want host.example", name)
+	}
+}
+
+func TestDisplayAddress(t *testing.T) {
+	var dns fakeDNS
+	dns.set("PTR 1.2.0.192.in-addr.arpa.", "host.example.")
+	dns.set("PTR 2.2.0.192.in-addr.arpa.", "ssh.test.")
+	e := NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh)
+	e.reverseDNS.lookup = dns.resolver().LookupAddr
+	remote := func(ip string) net.Addr { return &net.TCPAddr{IP: net.ParseIP(ip), Port: 22} }
+
+	tests := []struct {
+		name       string
+		reverseDNS bool
+		remote     net.Addr
+		want       string
+	}{
+		{"disabled", false, remote("192.0.2.1"), "ssh.test:22"},
+		{"named", true, remote("192.0.2.1"), "ssh.test:22 (host.example)"},
+		{"same as the host", true, remote("192.0.2.2"), "ssh.test:22"},
+		{"no name", true, remote("192.0.2.3"), "ssh.test:22"},
+		{"no remote", true, nil, "ssh.test:22"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e.Base.Data.ReverseDNS = tt.reverseDNS
+			if got := e.displayAddress("ssh.test:22", tt.remote); got != tt.want {
+				t.Errorf("displayAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package hiddify_extension
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+// parseDNSServers parses a comma-separated list of DNS servers into host:port addresses
+func parseDNSServers(value string) ([]string, error) {
+	var servers []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		// Accept a bare IP or IP:port, defaulting to port 53
+		host, port := entry, "53"
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			host, port = h, p
+		}
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("local DNS server %q must be an IP address", entry)
+		}
+		if _, err := net.LookupPort("udp", port); err != nil {
+			return nil, fmt.Errorf("local DNS server %q has an invalid port", entry)
+		}
+		servers = append(servers, net.JoinHostPort(host, port))
+	}
+	return servers, nil
+}
+
+// localResolver returns a resolver that queries the configured DNS servers, or nil for the system resolver
+func (e *HiddifyExtensionSimpleSsh) localResolver() *net.Resolver {
+	servers, err := parseDNSServers(e.data().LocalDNS)
+	if err != nil || len(servers) == 0 {
+		e.addAndUpdateConsole(yellow.Sprint("Local resolver: "), "system")
+		return nil
+	}
+	e.addAndUpdateConsole(yellow.Sprint("Local resolver: "), strings.Join(servers, ", "))
+
+	// Rotate through the servers so retries reach the next one
+	var next atomic.Uint32
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			server := servers[int(next.Add(1)-1)%len(servers)]
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// resolverKey carries the resolver of a connect through its context
+type resolverKey struct{}
+
+// withResolver builds the resolver once for a connect, so its retries and hops reuse it and
+// the choice is logged only once
+func (e *HiddifyExtensionSimpleSsh) withResolver(ctx context.Context) context.Context {
+	return context.WithValue(ctx, resolverKey{}, e.localResolver())
+}
+
+// connectResolver returns the resolver built for the connect, or builds one for a dial made
+// outside a connect
+func (e *HiddifyExtensionSimpleSsh) connectResolver(ctx context.Context) *net.Resolver {
+	if resolver, ok := ctx.Value(resolverKey{}).(*net.Resolver); ok {
+		return resolver
+	}
+	return e.localResolver()
+}
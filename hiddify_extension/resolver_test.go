@@ -0,0 +1,155 @@
+package hiddify_extension
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeDNS is a DNS server answering A and PTR queries from its records, reached through the
+// resolver returned by resolver without touching the network
+type fakeDNS struct {
+	mu      sync.Mutex
+	records map[string]string // Answer by query type and absolute name, e.g. "A ssh.test."
+	hang    bool              // Never answers, like an unreachable server
+	queries atomic.Int32      // Queries received so far
+}
+
+// set changes the answer to a query, e.g. set("A ssh.test.", "192.0.2.1")
+func (f *fakeDNS) set(query, answer string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.records == nil {
+		f.records = make(map[string]string)
+	}
+	f.records[query] = answer
+}
+
+// resolver returns a pure Go resolver that sends its queries to f over an in-memory stream
+func (f *fakeDNS) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go f.serve(server)
+			return client, nil
+		},
+	}
+}
+
+// serve answers length-prefixed queries, as sent over TCP, until the client closes the stream
+func (f *fakeDNS) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		f.queries.Add(1)
+		if f.hang {
+			continue
+		}
+		reply := f.answer(query)
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(reply))), reply...)); err != nil {
+			return
+		}
+	}
+}
+
+// answer builds the reply to a single-question query: the record if known, no answer for other
+// types of a known name, and NXDOMAIN for unknown names
+func (f *fakeDNS) answer(query []byte) []byte {
+	name, end := "", 12
+	for query[end] != 0 {
+		length := int(query[end])
+		name += string(query[end+1:end+1+length]) + "."
+		end += 1 + length
+	}
+	end++
+	qtype := binary.BigEndian.Uint16(query[end:])
+
+	f.mu.Lock()
+	a, ptr := f.records["A "+name], f.records["PTR "+name]
+	f.mu.Unlock()
+	var rdata []byte
+	switch {
+	case qtype == 1 && a != "":
+		rdata = net.ParseIP(a).To4()
+	case qtype == 12 && ptr != "":
+		for _, label := range strings.Split(strings.TrimSuffix(ptr, "."), ".") {
+			rdata = append(append(rdata, byte(len(label))), label...)
+		}
+		rdata = append(rdata, 0)
+	}
+
+	flags := uint16(0x8180) // Response, recursion desired and available
+	if a == "" && ptr == "" {
+		flags |= 3 // NXDOMAIN
+	}
+	reply := binary.BigEndian.AppendUint16(append([]byte(nil), query[:2]...), flags)
+	answers := uint16(0)
+	if rdata != nil {
+		answers = 1
+	}
+	for _, count := range []uint16{1, answers, 0, 0} {
+		reply = binary.BigEndian.AppendUint16(reply, count)
+	}
+	reply = append(reply, query[12:end+4]...) // The question
+	if rdata != nil {
+		reply = append(reply, 0xc0, 12) // Name of the question
+		reply = binary.BigEndian.AppendUint16(reply, qtype)
+		reply = binary.BigEndian.AppendUint16(reply, 1) // Class IN
+		reply = binary.BigEndian.AppendUint32(reply, 60)
+		reply = binary.BigEndian.AppendUint16(reply, uint16(len(rdata)))
+		reply = append(reply, rdata...)
+	}
+	return reply
+}
+
+func TestConnectResolverIsBuiltOnce(t *testing.T) {
+	for _, dns := range []string{"", "192.0.2.1, 192.0.2.2:5353"} {
+		e := NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh)
+		e.Base.Data.LocalDNS = dns
+		ctx := e.withResolver(context.Background())
+		first := e.connectResolver(ctx)
+		for i := 0; i < 3; i++ {
+			if resolver := e.connectResolver(ctx); resolver != first {
+				t.Fatalf("LocalDNS %q: dial %d got a different resolver", dns, i+2)
+			}
+		}
+		if (first == nil) != (dns == "") {
+			t.Errorf("LocalDNS %q: resolver = %v", dns, first)
+		}
+		if count := strings.Count(e.consoleText(), "Local resolver"); count != 1 {
+			t.Errorf("LocalDNS %q: resolver logged %d times, want once", dns, count)
+		}
+	}
+}
+
+func TestFakeDNS(t *testing.T) {
+	var dns fakeDNS
+	dns.set("A ssh.test.", "192.0.2.1")
+	dns.set("PTR 1.2.0.192.in-addr.arpa.", "host.example.")
+	resolver := dns.resolver()
+
+	ips, err := resolver.LookupIPAddr(context.Background(), "ssh.test")
+	if err != nil || len(ips) != 1 || ips[0].IP.String() != "192.0.2.1" {
+		t.Errorf("LookupIPAddr() = %v, %v, want 192.0.2.1", ips, err)
+	}
+	names, err := resolver.LookupAddr(context.Background(), "192.0.2.1")
+	if err != nil || len(names) != 1 || names[0] != "host.example." {
+		t.Errorf("LookupAddr() = %v, %v, want host.example.", names, err)
+	}
+	if _, err := resolver.LookupIPAddr(context.Background(), "missing.test"); err == nil {
+		t.Error("LookupIPAddr() of an unknown name succeeded")
+	}
+}
@@ -0,0 +1,190 @@
+package hiddify_extension
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Connection retry settings
+const (
+	defaultConnectAttempts   = 3
+	defaultConnectTimeout    = 5                // Seconds allowed for the first attempt
+	defaultConnectTimeoutMax = 30               // Seconds allowed for later attempts at most
+	retryBaseDelay           = time.Second      // Delay before the first retry, doubled for each further one
+	retryMaxDelay            = 30 * time.Second // Longest delay between attempts
+)
+
+// hostKeyError marks a rejected server host key
+type hostKeyError struct {
+	err error
+}
+
+// Error returns the host key verification failure
+func (h *hostKeyError) Error() string {
+	return h.err.Error()
+}
+
+// Unwrap returns the underlying error
+func (h *hostKeyError) Unwrap() error {
+	return h.err
+}
+
+// permanentHostKeyErrors wraps a host key callback so its failures can be told apart from network errors
+func permanentHostKeyErrors(callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := callback(hostname, remote, key); err != nil {
+			return &hostKeyError{err}
+		}
+		return nil
+	}
+}
+
+// classifyConnectError names the kind of connection failure and whether retrying cannot help
+func classifyConnectError(err error) (kind string, permanent bool) {
+	var hostKeyErr *hostKeyError
+	msg := err.Error()
+	switch {
+	case errors.As(err, &hostKeyErr):
+		return "host key", true
+	case strings.Contains(msg, "unable to authenticate"), strings.Contains(strings.ToLower(msg), "too many authentication failures"):
+		return "authentication", true
+	case strings.Contains(msg, "no common algorithm"):
+		return "algorithm negotiation", true
+	}
+	if description, permanent := serverDisconnect(err); description != "" {
+		return "server disconnect (" + description + ")", permanent
+	}
+	return "network", false
+}
+
+// retryDelay returns the delay before the given retry, doubling up to retryMaxDelay
+func retryDelay(retry int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < retry && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMaxDelay)
+}
+
+// attemptTimeout returns the timeout of the given attempt, doubling from ConnectTimeout up to ConnectTimeoutMax
+func (e *HiddifyExtensionSimpleSsh) attemptTimeout(attempt int) time.Duration {
+	data := e.data()
+	timeout := time.Duration(max(data.ConnectTimeout, 1)) * time.Second
+	limit := max(time.Duration(data.ConnectTimeoutMax)*time.Second, timeout)
+	for i := 1; i < attempt && timeout < limit; i++ {
+		timeout *= 2
+	}
+	return min(timeout, limit)
+}
+
+// readyTimeout returns how long a caller waits for the connection outcome: each attempt's
+// timeout for dialing and again for the handshake, at every port and jump host, plus the delays
+// between attempts
+func (e *HiddifyExtensionSimpleSsh) readyTimeout() time.Duration {
+	data := e.data()
+	attempts := max(data.ConnectAttempts, 1)
+	hops, _ := jumpHostAddresses(data.JumpHosts) // Checked by the form
+	dials := time.Duration(len(e.candidatePorts()) * (len(hops) + 1))
+	var total time.Duration
+	for attempt := 1; attempt <= attempts; attempt++ {
+		total += 2 * e.attemptTimeout(attempt) * dials
+		if attempt < attempts {
+			total += retryDelay(attempt)
+		}
+	}
+	return total
+}
+
+// dialWithRetries connects to the server, retrying network failures up to ConnectAttempts times.
+// Each attempt tries the addresses in order until one connects, and returns the address used.
+// Authentication and host key failures are not retried unless RetryAuthErrors is set, since
+// repeating a wrong password can lock the account.
+func (e *HiddifyExtensionSimpleSsh) dialWithRetries(ctx context.Context, addresses []string, config *ssh.ClientConfig) (*ssh.Client, string, error) {
+	data := e.data()
+	attempts := max(data.ConnectAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		// Start short for fast failover and allow slow paths more time on retries
+		attemptConfig := *config
+		attemptConfig.Timeout = e.attemptTimeout(attempt)
+		e.addAndUpdateConsole(yellow.Sprintf("Attempt %d of %d: ", attempt, attempts), "timeout "+attemptConfig.Timeout.String())
+
+		client, address, err := e.dialAddresses(ctx, addresses, &attemptConfig)
+		if err == nil {
+			return client, address, nil
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			return nil, "", err
+		}
+
+		kind, permanent := classifyConnectError(err)
+		if permanent && !data.RetryAuthErrors {
+			e.addAndUpdateConsole(red.Sprint("Not retrying: "), kind+" failures are permanent")
+			return nil, "", err
+		}
+		delay := retryDelay(attempt)
+		e.addAndUpdateConsole(yellow.Sprintf("Retrying in %v: ", delay), fmt.Sprintf("%s failure, attempt %d of %d", kind, attempt+1, attempts))
+
+		select {
+		case <-ctx.Done():
+			return nil, "", err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// dialAddresses tries each address in order until one connects, remembering its port for
+// the next connection. Only network failures move on to the next address: any other failure
+// means the server was reached, and another port leads to the same server.
+func (e *HiddifyExtensionSimpleSsh) dialAddresses(ctx context.Context, addresses []string, config *ssh.ClientConfig) (*ssh.Client, string, error) {
+	var err error
+	for i, address := range addresses {
+		if len(addresses) > 1 {
+			e.addAndUpdateConsole(yellow.Sprintf("Trying address %d of %d: ", i+1, len(addresses)), address)
+		}
+		var client *ssh.Client
+		client, err = e.dialAttempt(ctx, address, config)
+		if err == nil {
+			_, port, _ := net.SplitHostPort(address)
+			e.workingPort.Store(port)
+			return client, address, nil
+		}
+		if kind, _ := classifyConnectError(err); kind != "network" || ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, "", err
+}
+
+// dialAttempt makes a single connection attempt, reporting the outcome to the console
+func (e *HiddifyExtensionSimpleSsh) dialAttempt(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if err := e.throttleAttempt(ctx, address); err != nil {
+		return nil, err
+	}
+	done := e.startProgress(dialPhase(e.data().IP) + " to " + address)
+	start := time.Now()
+	client, err := e.dialChain(ctx, address, config)
+	done()
+	if err != nil {
+		if len(config.HostKeyAlgorithms) > 0 && strings.Contains(err.Error(), "no common algorithm for host key") {
+			e.addAndUpdateConsole(red.Sprint("Failed to connect: "), "server offers none of the allowed host key algorithms: "+strings.Join(config.HostKeyAlgorithms, ", "))
+			return nil, err
+		}
+		if description, _ := serverDisconnect(err); description != "" {
+			e.addAndUpdateConsole(red.Sprint("Server disconnected: "), description)
+			return nil, err
+		}
+		e.addAndUpdateConsole(red.Sprint("Failed to connect: "), err.Error())
+		if hint := connectErrorHint(err); hint != "" {
+			e.addAndUpdateConsole(yellow.Sprint("Hint: "), hint)
+		}
+		return nil, err
+	}
+	e.recordLatency(time.Since(start))
+	return client, nil
+}
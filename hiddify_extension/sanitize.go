@@ -0,0 +1,39 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// sanitizeText makes text received from the server safe to show in the console. Invalid UTF-8
+// is replaced, CRLF line endings become newlines, and other control characters, such as the
+// escape sequences a server could use to rewrite the display, are shown escaped like \x1b.
+func sanitizeText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if utf8.ValidString(text) && strings.IndexFunc(text, unsafeRune) < 0 {
+		return text // Nothing to change, the common case
+	}
+
+	var sb strings.Builder
+	for len(text) > 0 {
+		r, size := utf8.DecodeRuneInString(text)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			sb.WriteRune(utf8.RuneError)
+		case unsafeRune(r) && r < 0x80:
+			fmt.Fprintf(&sb, `\x%02x`, r)
+		case unsafeRune(r):
+			fmt.Fprintf(&sb, `\u%04x`, r)
+		default:
+			sb.WriteRune(r)
+		}
+		text = text[size:]
+	}
+	return sb.String()
+}
+
+// unsafeRune reports whether r is a control character other than a newline or tab
+func unsafeRune(r rune) bool {
+	return (r < ' ' && r != '\n' && r != '\t') || (r >= 0x7f && r <= 0x9f)
+}
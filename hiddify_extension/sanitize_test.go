@@ -0,0 +1,29 @@
+package hiddify_extension
+
+import "testing"
+
+func TestSanitizeText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", "uptime: 3 days\n\tload 0.1", "uptime: 3 days\n\tload 0.1"},
+		{"crlf", "one\r\ntwo\r\n", "one\ntwo\n"},
+		{"lone carriage return", "100%\rdone", `100%\x0ddone`},
+		{"ansi color", "\x1b[31mred\x1b[0m", `\x1b[31mred\x1b[0m`},
+		{"clear screen", "\x1b[2J\x1b[H", `\x1b[2J\x1b[H`},
+		{"bell and backspace", "a\x07b\x08", `a\x07b\x08`},
+		{"delete", "a\x7f", `a\x7f`},
+		{"c1 control", "a\u009bb", `a\u009bb`},
+		{"invalid utf-8", "a\xffb\xc3", "a�b�"},
+		{"valid utf-8", "héllo 世界", "héllo 世界"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeText(tt.text); got != tt.want {
+				t.Errorf("sanitizeText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// openFileCount returns the number of open file descriptors, or -1 where /proc is not available
+func openFileCount() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries) - 1 // Leave out the descriptor used to read the directory
+}
+
+// selfCheck logs the process resources that would grow if connections leaked
+func (e *HiddifyExtensionSimpleSsh) selfCheck() {
+	files := "unavailable"
+	if count := openFileCount(); count >= 0 {
+		files = fmt.Sprint(count)
+	}
+	e.shellMu.Lock()
+	shell := e.shell != nil
+	e.shellMu.Unlock()
+
+	// Counts cover the whole app, so compare them across reconnects rather than reading them alone
+	e.addAndUpdateConsole(yellow.Sprint("Self-check: "), fmt.Sprintf("%d goroutines, %s open files, state %s, shell open: %t",
+		runtime.NumGoroutine(), files, e.State(), shell))
+}
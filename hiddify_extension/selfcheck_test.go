@@ -0,0 +1,65 @@
+package hiddify_extension
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSelfCheckAfterCancel(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+	e.Base.Data.ServerAliveInterval = 1 // Runs the keepalive goroutine while connected
+	dialer := server.dialer()
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 10; i++ {
+		// Every other task is cancelled while connecting, the others once connected
+		connected := make(chan struct{})
+		e.SetDialer(DialerFunc(func(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+			if i%2 == 0 {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			defer close(connected)
+			return dialer.DialSSH(ctx, address, config)
+		}))
+		ctx, task, err := e.lifecycle.start(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan struct{})
+		go func() {
+			e.backgroundTask(ctx, task, nil)
+			close(done)
+		}()
+		if i%2 == 1 {
+			<-connected
+		}
+		e.Cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("background task kept running after Cancel")
+		}
+	}
+
+	// Connections close asynchronously, give their goroutines a moment to exit
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		buf := make([]byte, 1<<20)
+		t.Errorf("%d goroutines after connecting and cancelling, %d before:\n%s", after, before, buf[:runtime.Stack(buf, true)])
+	}
+
+	e.selfCheck()
+	if !strings.Contains(e.consoleText(), "state idle, shell open: false") {
+		t.Errorf("self-check does not report the idle state:\n%s", e.consoleText())
+	}
+}
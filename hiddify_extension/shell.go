@@ -0,0 +1,270 @@
+package hiddify_extension
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	ui "github.com/hiddify/hiddify-core/extension/ui"
+	"golang.org/x/crypto/ssh"
+)
+
+// Execution modes
+const (
+	ModeCommand   = "command"
+	ModeShell     = "shell"
+	ModeSubsystem = "subsystem"
+)
+
+// Interactive shell settings
+const (
+	defaultShellColumns = 80
+	defaultShellRows    = 24
+	shellIdleTimeout    = 10 * time.Minute // Close the shell after this long without input
+	maxShellOutput      = 64 * 1024        // Bytes of shell output kept for display
+)
+
+// shellSession is an interactive PTY session kept open across form submissions
+type shellSession struct {
+	client   *ssh.Client
+	session  *ssh.Session
+	cleanup  func() // Releases resources held for the session
+	stdin    io.WriteCloser
+	activity chan struct{} // Signals user input to reset the idle timer
+	columns  int
+	rows     int
+}
+
+// send writes an input line to the shell
+func (s *shellSession) send(line string) error {
+	select {
+	case s.activity <- struct{}{}:
+	default:
+	}
+	_, err := s.stdin.Write([]byte(line + "\n"))
+	return err
+}
+
+// resize updates the remote terminal size if it changed
+func (s *shellSession) resize(columns int, rows int) error {
+	if columns == s.columns && rows == s.rows {
+		return nil
+	}
+	s.columns, s.rows = columns, rows
+	return s.session.WindowChange(rows, columns)
+}
+
+// shellFields returns the form fields used to interact with the shell
+func (e *HiddifyExtensionSimpleSsh) shellFields() []ui.FormField {
+	data := e.data()
+	return []ui.FormField{
+		{
+			Type:        ui.FieldInput,
+			Key:         ShellColumnsKey,
+			Label:       "Terminal Columns",
+			Placeholder: "Width of the remote terminal",
+			Required:    true,
+			Value:       strconv.Itoa(data.ShellColumns),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         ShellRowsKey,
+			Label:       "Terminal Rows",
+			Placeholder: "Height of the remote terminal",
+			Required:    true,
+			Value:       strconv.Itoa(data.ShellRows),
+			Validator:   ui.ValidatorDigitsOnly, // Only allow digits
+		},
+		{
+			Type:        ui.FieldInput,
+			Key:         ShellInputKey,
+			Label:       "Shell Input",
+			Placeholder: "Type a line and submit to send it to the shell",
+		},
+		{
+			Type:  ui.FieldConsole,
+			Key:   "shell_output",
+			Label: "Shell Output",
+			Value: e.shellText(),
+			Lines: 20,
+		},
+	}
+}
+
+// sendShellInput sends input to the open shell, returning false when no shell is open
+func (e *HiddifyExtensionSimpleSsh) sendShellInput(input string) bool {
+	data := e.data()
+	e.shellMu.Lock()
+	shell := e.shell
+	e.shellMu.Unlock()
+	if shell == nil {
+		return false
+	}
+
+	if err := shell.resize(data.ShellColumns, data.ShellRows); err != nil {
+		e.addAndUpdateConsole(red.Sprint("Failed to resize terminal: "), err.Error())
+	}
+	if input != "" {
+		e.recordTranscript("stdin", input+"\n")
+		if err := shell.send(input); err != nil {
+			e.addAndUpdateConsole(red.Sprint("Failed to send shell input: "), err.Error())
+		}
+	}
+	return true
+}
+
+// shellTask opens an interactive shell as the lifecycle's task and keeps it running until it
+// exits, idles out or the task is cancelled
+func (e *HiddifyExtensionSimpleSsh) shellTask(ctx context.Context, task uint64, input string, ready chan<- error) {
+	defer func() {
+		e.lifecycle.finished(task)
+		e.UpdateUI(e.form()) // Show the final state
+	}()
+
+	shell, err := e.openShell(ctx)
+	notifyReady(ready, err)
+	if err != nil {
+		if ctx.Err() == nil {
+			e.connectFailed(task, err)
+		}
+		return
+	}
+	e.shellMu.Lock()
+	e.shell = shell
+	e.shellMu.Unlock()
+	e.lifecycle.connected(task)
+	defer func() {
+		shell.session.Close()
+		shell.client.Close()
+		shell.cleanup()
+		e.shellMu.Lock()
+		e.shell = nil
+		e.shellMu.Unlock()
+	}()
+	e.addAndUpdateConsole(green.Sprint("Interactive shell opened"))
+
+	// Explain why the server closes the connection, if it says
+	go e.watchDisconnect(shell.client)
+
+	// Drop the connection if the server stops answering
+	go e.keepAlive(ctx, shell.client)
+
+	if input != "" {
+		e.recordTranscript("stdin", input+"\n")
+		shell.send(input)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- shell.session.Wait() }()
+
+	idle := time.NewTimer(shellIdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case err := <-exited:
+			if err != nil {
+				e.addAndUpdateConsole(yellow.Sprint("Interactive shell closed: "), err.Error())
+			} else {
+				e.addAndUpdateConsole(yellow.Sprint("Interactive shell closed"))
+			}
+			return
+		case <-ctx.Done():
+			e.addAndUpdateConsole(yellow.Sprint("Interactive shell closed"))
+			return
+		case <-shell.activity:
+			idle.Reset(shellIdleTimeout)
+		case <-idle.C:
+			e.addAndUpdateConsole(yellow.Sprint("Interactive shell closed after "), shellIdleTimeout.String()+" without input")
+			return
+		}
+	}
+}
+
+// openShell connects and starts a shell on a new pseudo-terminal
+func (e *HiddifyExtensionSimpleSsh) openShell(ctx context.Context) (*shellSession, error) {
+	data := e.data()
+	client, err := e.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !e.runPostConnect(ctx, client) {
+		client.Close()
+		return nil, errors.New("post-connect steps failed")
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		e.addAndUpdateConsole(red.Sprint("Failed to create SSH session: "), err.Error())
+		return nil, err
+	}
+
+	shell := &shellSession{
+		client:   client,
+		session:  session,
+		activity: make(chan struct{}, 1),
+		columns:  data.ShellColumns,
+		rows:     data.ShellRows,
+	}
+	e.startTranscript("interactive shell")
+	shell.cleanup = func() {}
+	if data.ForwardAgent {
+		if shell.cleanup, err = e.forwardAgent(client, session); err != nil {
+			session.Close()
+			client.Close()
+			e.addAndUpdateConsole(red.Sprint("Failed to forward SSH agent: "), err.Error())
+			return nil, err
+		}
+	}
+	if shell.stdin, err = session.StdinPipe(); err == nil {
+		session.Stdout = transcriptWriter{e, shellOutputWriter{e}, "stdout"}
+		session.Stderr = transcriptWriter{e, shellOutputWriter{e}, "stderr"}
+
+		// A dumb terminal keeps cursor control sequences out of the console
+		modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+		if err = session.RequestPty("dumb", shell.rows, shell.columns, modes); err == nil {
+			err = session.Shell()
+		}
+	}
+	if err != nil {
+		shell.cleanup()
+		session.Close()
+		client.Close()
+		e.addAndUpdateConsole(red.Sprint("Failed to start shell: "), err.Error())
+		return nil, err
+	}
+	return shell, nil
+}
+
+// shellText returns the buffered shell output, sanitized for display
+func (e *HiddifyExtensionSimpleSsh) shellText() string {
+	e.shellMu.Lock()
+	defer e.shellMu.Unlock()
+	return sanitizeText(e.shellOutput)
+}
+
+// shellOutputWriter appends shell output to the shell console
+type shellOutputWriter struct {
+	e *HiddifyExtensionSimpleSsh
+}
+
+// Write buffers the output, keeping only the most recent bytes, and refreshes the UI
+func (w shellOutputWriter) Write(p []byte) (int, error) {
+	w.e.shellMu.Lock()
+	output := w.e.shellOutput + string(p)
+	if len(output) > maxShellOutput {
+		output = output[len(output)-maxShellOutput:]
+		for len(output) > 0 && !utf8.RuneStart(output[0]) {
+			output = output[1:] // Do not start in the middle of a character
+		}
+	}
+	w.e.shellOutput = output
+	w.e.shellMu.Unlock()
+
+	w.e.UpdateUI(w.e.form())
+	return len(p), nil
+}
@@ -0,0 +1,45 @@
+package hiddify_extension
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestShellCancelWhileConnecting(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+	e.Base.Data.Mode = ModeShell
+	dialing := make(chan struct{})
+	e.SetDialer(DialerFunc(func(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		close(dialing)
+		<-ctx.Done() // A server that never answers
+		return nil, ctx.Err()
+	}))
+
+	ctx, task, err := e.lifecycle.start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		e.shellTask(ctx, task, "", nil)
+		close(done)
+	}()
+	<-dialing
+	if state := e.State(); state != StateConnecting {
+		t.Fatalf("State() = %s while the shell connects, want %s", state, StateConnecting)
+	}
+
+	e.Cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shell task kept connecting after Cancel")
+	}
+	if state := e.State(); state != StateIdle {
+		t.Errorf("State() = %s after Cancel, want %s", state, StateIdle)
+	}
+}
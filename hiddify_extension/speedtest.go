@@ -0,0 +1,152 @@
+package hiddify_extension
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Speed test settings
+const (
+	defaultSpeedTestMB   = 10
+	maxSpeedTestMB       = 1024
+	speedTestPhase       = 20 * time.Second // Longest time spent on each direction
+	speedTestPings       = 3                // Round trips timed for the latency
+	speedTestChunkSize   = 32 * 1024        // Size of each upload write
+	speedTestPingTimeout = 5 * time.Second
+)
+
+// speedTestTask measures latency, download and upload rates over a separate connection, so the
+// running command or shell is left alone, though both share the link while the test runs
+func (e *HiddifyExtensionSimpleSsh) speedTestTask() {
+	defer e.speedTesting.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*speedTestPhase+time.Minute)
+	defer cancel()
+
+	if e.tunnelUp() {
+		e.addAndUpdateConsole(yellow.Sprint("Speed test: "), "the connection in use shares the link, its traffic lowers the results and is slowed while the test runs")
+	}
+	client, err := e.connect(ctx)
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	size := int64(e.data().SpeedTestMB) * 1024 * 1024
+	if latency, err := speedTestLatency(client); err != nil {
+		e.addAndUpdateConsole(red.Sprint("Speed test latency failed: "), err.Error())
+	} else {
+		e.addAndUpdateConsole(green.Sprint("Speed test latency: "), fmt.Sprintf("%v (best of %d round trips)", latency.Round(100*time.Microsecond), speedTestPings))
+	}
+	for _, phase := range []struct {
+		name string
+		run  func(context.Context, *ssh.Client, int64) (int64, error)
+	}{{"download", speedTestDownload}, {"upload", speedTestUpload}} {
+		phaseCtx, stop := context.WithTimeout(ctx, speedTestPhase)
+		start := time.Now()
+		moved, err := phase.run(phaseCtx, client, size)
+		elapsed := time.Since(start)
+		stop()
+
+		switch {
+		case moved == 0 && err != nil:
+			e.addAndUpdateConsole(red.Sprintf("Speed test %s failed: ", phase.name), sanitizeText(err.Error())+" (the server needs a POSIX shell)")
+			continue
+		case moved < size:
+			e.addAndUpdateConsole(yellow.Sprintf("Speed test %s stopped early: ", phase.name), fmt.Sprintf("%d of %d bytes within %v", moved, size, speedTestPhase))
+		}
+		e.addAndUpdateConsole(green.Sprintf("Speed test %s: ", phase.name), fmt.Sprintf("%.1f Mbps (%d bytes in %v)", mbps(moved, elapsed), moved, elapsed.Round(time.Millisecond)))
+	}
+}
+
+// speedTestLatency returns the fastest of a few global request round trips. Any reply, even a
+// failure, completes a round trip.
+func speedTestLatency(client *ssh.Client) (time.Duration, error) {
+	var best time.Duration
+	for i := 0; i < speedTestPings; i++ {
+		reply := make(chan error, 1)
+		start := time.Now()
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+		select {
+		case err := <-reply:
+			if err != nil {
+				return 0, err
+			}
+		case <-time.After(speedTestPingTimeout):
+			return 0, fmt.Errorf("no reply within %v", speedTestPingTimeout)
+		}
+		if rtt := time.Since(start); best == 0 || rtt < best {
+			best = rtt
+		}
+	}
+	return best, nil
+}
+
+// speedTestDownload reads size bytes generated by the server and returns how many arrived
+func speedTestDownload(ctx context.Context, client *ssh.Client, size int64) (int64, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	defer stop()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := session.Start(fmt.Sprintf("head -c %d /dev/zero", size)); err != nil {
+		return 0, err
+	}
+	moved, err := io.Copy(io.Discard, stdout)
+	if err == nil {
+		err = session.Wait()
+	}
+	return moved, err
+}
+
+// speedTestUpload sends size bytes the server discards and returns how many were sent. The
+// server's exit confirms the data arrived.
+func speedTestUpload(ctx context.Context, client *ssh.Client, size int64) (int64, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	defer stop()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := session.Start("cat > /dev/null"); err != nil {
+		return 0, err
+	}
+	chunk := make([]byte, speedTestChunkSize)
+	var moved int64
+	for moved < size {
+		n, err := stdin.Write(chunk[:min(int64(len(chunk)), size-moved)])
+		moved += int64(n)
+		if err != nil {
+			return moved, err
+		}
+	}
+	stdin.Close()
+	return moved, session.Wait()
+}
+
+// mbps converts bytes moved over elapsed into megabits per second
+func mbps(bytes int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / elapsed.Seconds() / 1e6
+}
@@ -0,0 +1,39 @@
+package hiddify_extension
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSpeedTestAlongsideConnection(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+	e.speedTesting.Store(true)
+
+	// The speed test reports to the console while another connection does
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		e.speedTestTask()
+	}()
+	go func() {
+		defer wg.Done()
+		if client, err := e.connect(context.Background()); err == nil {
+			client.Close()
+		}
+	}()
+	wg.Wait()
+
+	if e.speedTesting.Load() {
+		t.Error("speed test still marked as running")
+	}
+	console := e.consoleText()
+	for _, want := range []string{"Speed test latency:", "Speed test download failed", "Speed test upload failed"} {
+		if !strings.Contains(console, want) {
+			t.Errorf("console lacks %q:\n%s", want, console)
+		}
+	}
+}
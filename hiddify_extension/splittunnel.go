@@ -0,0 +1,174 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hiddify/hiddify-core/config"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
+)
+
+// Split tunnel rule kinds, written as "kind:value" lines
+const (
+	SplitDomain  = "domain"  // Domain and its subdomains
+	SplitProcess = "process" // Desktop process name
+	SplitPackage = "package" // Android package name
+)
+
+// Android package names, such as com.example.app
+var packagePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*(\.[A-Za-z][A-Za-z0-9_]*)+$`)
+
+// splitTunnelRules are the destinations and apps routed through the SSH outbound
+type splitTunnelRules struct {
+	domains   []string
+	processes []string
+	packages  []string
+}
+
+// parseSplitTunnelRules parses one "kind:value" rule per line; blank lines and # comments are ignored
+func parseSplitTunnelRules(value string) (splitTunnelRules, error) {
+	var rules splitTunnelRules
+	for i, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kind, entry, ok := strings.Cut(line, ":")
+		kind, entry = strings.ToLower(strings.TrimSpace(kind)), strings.TrimSpace(entry)
+		if !ok || entry == "" {
+			return rules, fmt.Errorf("rule on line %d must be written as domain:, process: or package: followed by a value", i+1)
+		}
+
+		switch kind {
+		case SplitDomain:
+			entry = strings.ToLower(strings.Trim(entry, "."))
+			if entry == "" || strings.ContainsAny(entry, " /:*") {
+				return rules, fmt.Errorf("invalid domain %q on line %d", entry, i+1)
+			}
+			rules.domains = appendUnique(rules.domains, entry)
+		case SplitProcess:
+			if strings.ContainsAny(entry, `/\`) {
+				return rules, fmt.Errorf("process on line %d must be a name, not a path", i+1)
+			}
+			rules.processes = appendUnique(rules.processes, entry)
+		case SplitPackage:
+			if !packagePattern.MatchString(entry) {
+				return rules, fmt.Errorf("invalid package name %q on line %d", entry, i+1)
+			}
+			rules.packages = appendUnique(rules.packages, entry)
+		default:
+			return rules, fmt.Errorf("unknown rule kind %q on line %d, use domain, process or package", kind, i+1)
+		}
+	}
+	return rules, nil
+}
+
+// appendUnique appends value unless the list already holds it
+func appendUnique(list []string, value string) []string {
+	if slices.Contains(list, value) {
+		return list
+	}
+	return append(list, value)
+}
+
+// routeRules returns one sing-box rule per kind, since different kinds in a single rule must all match
+func (r splitTunnelRules) routeRules() []option.Rule {
+	var rules []option.Rule
+	add := func(rule option.DefaultRule) {
+		rule.Outbound = outboundTag
+		rules = append(rules, option.Rule{Type: C.RuleTypeDefault, DefaultOptions: rule})
+	}
+	if len(r.domains) > 0 {
+		add(option.DefaultRule{DomainSuffix: r.domains})
+	}
+	if len(r.processes) > 0 {
+		add(option.DefaultRule{ProcessName: r.processes})
+	}
+	if len(r.packages) > 0 {
+		add(option.DefaultRule{PackageName: r.packages})
+	}
+	return rules
+}
+
+// BeforeAppConnect adds the SSH outbound and the split tunnel rules to the sing-box configuration.
+// Nothing is added unless split tunnel rules are set, so other traffic keeps its routing.
+func (e *HiddifyExtensionSimpleSsh) BeforeAppConnect(hiddifySettings *config.HiddifyOptions, singconfig *option.Options) error {
+	data := e.data()
+	rules, err := parseSplitTunnelRules(data.SplitTunnelRules)
+	if err != nil || data.SplitTunnelRules == "" {
+		return err
+	}
+	for _, outbound := range singconfig.Outbounds {
+		if outbound.Tag == outboundTag {
+			e.addAndUpdateConsole(red.Sprint("Split tunnel skipped: "), fmt.Sprintf("the configuration already has an outbound tagged %q", outboundTag))
+			return nil
+		}
+	}
+	if err := upstreamExists(singconfig.Outbounds, data.UpstreamOutbound); err != nil {
+		e.addAndUpdateConsole(red.Sprint("Split tunnel skipped: "), err.Error())
+		return err
+	}
+	outbound, err := e.singBoxOutbound(false)
+	if err != nil {
+		e.addAndUpdateConsole(red.Sprint("Split tunnel skipped: "), err.Error())
+		return err
+	}
+	for _, note := range e.outboundNotes() {
+		e.addAndUpdateConsole(yellow.Sprint("Split tunnel outbound: "), note)
+	}
+
+	// The rules go first so they win over the configuration's own rules
+	if singconfig.Route == nil {
+		singconfig.Route = &option.RouteOptions{}
+	}
+	singconfig.Outbounds = append(singconfig.Outbounds, outbound)
+	singconfig.Route.Rules = append(rules.routeRules(), singconfig.Route.Rules...)
+	if len(rules.processes) > 0 {
+		singconfig.Route.FindProcess = true // Process names are only known when looked up
+	}
+
+	for _, rule := range []struct {
+		kind    string
+		entries []string
+	}{{SplitDomain, rules.domains}, {SplitProcess, rules.processes}, {SplitPackage, rules.packages}} {
+		if len(rule.entries) > 0 {
+			e.addAndUpdateConsole(yellow.Sprintf("Split tunnel %s rule: ", rule.kind), strings.Join(rule.entries, ", ")+" -> "+outboundTag)
+		}
+	}
+	return nil
+}
+
+// validateUpstream checks that an upstream outbound is only set along with split tunnel rules.
+// Without rules no SSH outbound is added to sing-box, and the extension's own connection always
+// dials the server directly, so the upstream would silently do nothing.
+func validateUpstream(data HiddifyExtensionSimpleSshData) error {
+	if data.UpstreamOutbound != "" && data.SplitTunnelRules == "" {
+		return invalidField(UpstreamOutboundKey, fmt.Errorf("the upstream outbound only applies to split tunnel traffic, set split tunnel rules or clear it"))
+	}
+	return nil
+}
+
+// upstreamExists checks that the outbound the SSH outbound dials through is configured, naming
+// the available tags when it is not. An empty tag dials directly.
+func upstreamExists(outbounds []option.Outbound, tag string) error {
+	if tag == "" {
+		return nil
+	}
+	var tags []string
+	for _, outbound := range outbounds {
+		if outbound.Tag == tag {
+			return nil
+		}
+		if outbound.Tag != "" {
+			tags = append(tags, strconv.Quote(outbound.Tag))
+		}
+	}
+	if len(tags) == 0 {
+		return fmt.Errorf("upstream outbound %q does not exist, the configuration has no tagged outbounds", tag)
+	}
+	return fmt.Errorf("upstream outbound %q does not exist, available: %s", tag, strings.Join(tags, ", "))
+}
@@ -0,0 +1,19 @@
+package hiddify_extension
+
+import (
+	"golang.org/x/crypto/ssh"
+)
+
+// Subsystem requested when none is configured
+const defaultSubsystem = "sftp"
+
+// requestSubsystem asks the server to start the configured subsystem on the session and logs the outcome
+func (e *HiddifyExtensionSimpleSsh) requestSubsystem(session *ssh.Session) {
+	name := e.data().Subsystem
+	e.addAndUpdateConsole(yellow.Sprint("Requesting subsystem: "), name)
+	if err := session.RequestSubsystem(name); err != nil {
+		e.addAndUpdateConsole(red.Sprintf("Subsystem %q refused: ", name), err.Error())
+		return
+	}
+	e.addAndUpdateConsole(green.Sprint("Subsystem accepted: "), name)
+}
@@ -0,0 +1,55 @@
+package hiddify_extension
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Connect attempts per second allowed by default across the extension
+const defaultConnectRate = 2
+
+// connectThrottle spaces out connect attempts so a burst of reconnects, for example after a
+// network blip, does not hit the server or the network all at once
+type connectThrottle struct {
+	mu   sync.Mutex
+	next time.Time // Earliest start of the next attempt
+}
+
+// Shared by every connection the extension makes: commands, shells, key installs and speed tests
+var attemptThrottle connectThrottle
+
+// reserve books the next free slot at rate attempts per second and returns how long to wait for it
+func (t *connectThrottle) reserve(rate int) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	start := now
+	if t.next.After(now) {
+		start = t.next
+	}
+	t.next = start.Add(time.Second / time.Duration(rate))
+	return start.Sub(now)
+}
+
+// throttleAttempt waits until a connect attempt to address is allowed by ConnectRate
+func (e *HiddifyExtensionSimpleSsh) throttleAttempt(ctx context.Context, address string) error {
+	data := e.data()
+	wait := attemptThrottle.reserve(data.ConnectRate)
+	if wait <= 0 {
+		return nil
+	}
+	e.addAndUpdateConsole(yellow.Sprintf("Throttled for %v: ", wait.Round(time.Millisecond)), fmt.Sprintf("connect attempts are limited to %d per second, next is %s", data.ConnectRate, address))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
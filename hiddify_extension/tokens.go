@@ -0,0 +1,54 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// expandTokens replaces OpenSSH-style %-tokens in text with their values; %% is a literal percent
+func expandTokens(text string, tokens map[byte]string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] != '%' {
+			sb.WriteByte(text[i])
+			continue
+		}
+		i++
+		if i == len(text) {
+			return "", fmt.Errorf("%q ends with a lone %%, write %%%% for a literal percent sign", text)
+		}
+		if text[i] == '%' {
+			sb.WriteByte('%')
+			continue
+		}
+		value, ok := tokens[text[i]]
+		if !ok {
+			return "", fmt.Errorf("unknown token %%%c in %q, supported tokens are %%h, %%p, %%r, %%n and %%%%", text[i], text)
+		}
+		sb.WriteString(value)
+	}
+	return sb.String(), nil
+}
+
+// commandTokens returns the values of the tokens expanded in remote commands: %h the server host,
+// %p the port the last connection reached, %r the remote user and %n the configured host:port
+func (e *HiddifyExtensionSimpleSsh) commandTokens() map[byte]string {
+	data := e.data()
+	port, _ := e.workingPort.Load().(string)
+	if port == "" {
+		port = data.Port
+	}
+	return map[byte]string{
+		'h': data.IP,
+		'p': port,
+		'r': data.Username,
+		'n': net.JoinHostPort(data.IP, data.Port),
+	}
+}
+
+// validateTokens checks that text only uses supported tokens
+func validateTokens(text string) error {
+	_, err := expandTokens(text, (&HiddifyExtensionSimpleSsh{}).commandTokens())
+	return err
+}
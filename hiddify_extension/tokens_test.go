@@ -0,0 +1,39 @@
+package hiddify_extension
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandTokens(t *testing.T) {
+	tokens := map[byte]string{'h': "ssh.test", 'p': "2222", 'r': "user", 'n': "ssh.test:22"}
+	tests := []struct {
+		text    string
+		want    string
+		wantErr string
+	}{
+		{"ssh %r@%h -p %p", "ssh user@ssh.test -p 2222", ""},
+		{"nc %n", "nc ssh.test:22", ""},
+		{"date +%%s", "date +%s", ""},
+		{"no tokens", "no tokens", ""},
+		{"100%", "", "lone %"},
+		{"date +%s", "", "unknown token %s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := expandTokens(tt.text, tokens)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expandTokens() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandTokens() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expandTokens() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
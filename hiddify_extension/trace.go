@@ -0,0 +1,91 @@
+package hiddify_extension
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Size of the connection trace file when none is configured
+const defaultTraceMaxSizeKB = 1024
+
+// traceRecord is one line of the connection trace file
+type traceRecord struct {
+	Kind          string    `json:"kind"` // "ssh" for server connections, "tunnel" for channels through the server
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	DurationMS    int64     `json:"duration_ms"`
+	Source        string    `json:"source"`
+	Destination   string    `json:"destination"`
+	Target        string    `json:"target"` // Address as requested, before resolution
+	BytesSent     int64     `json:"bytes_sent"`
+	BytesReceived int64     `json:"bytes_received"`
+}
+
+// tracedConn counts the bytes of a connection and writes a trace record when it is closed
+type tracedConn struct {
+	net.Conn
+	e        *HiddifyExtensionSimpleSsh
+	record   traceRecord
+	sent     atomic.Int64
+	received atomic.Int64
+	once     sync.Once
+}
+
+// traceConn wraps conn to be traced when connection tracing is enabled
+func (e *HiddifyExtensionSimpleSsh) traceConn(conn net.Conn, kind string, target string) net.Conn {
+	if e.data().TraceFilePath == "" {
+		return conn
+	}
+	return &tracedConn{Conn: conn, e: e, record: traceRecord{
+		Kind:        kind,
+		Start:       time.Now(),
+		Source:      conn.LocalAddr().String(),
+		Destination: conn.RemoteAddr().String(),
+		Target:      target,
+	}}
+}
+
+// Read counts received bytes
+func (c *tracedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.received.Add(int64(n))
+	return n, err
+}
+
+// Write counts sent bytes
+func (c *tracedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.sent.Add(int64(n))
+	return n, err
+}
+
+// Close closes the connection and writes its trace record once
+func (c *tracedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		record := c.record
+		record.End = time.Now()
+		record.DurationMS = record.End.Sub(record.Start).Milliseconds()
+		record.BytesSent, record.BytesReceived = c.sent.Load(), c.received.Load()
+		c.e.writeTrace(record)
+	})
+	return err
+}
+
+// writeTrace appends a record to the trace file, keeping one rotated file
+func (e *HiddifyExtensionSimpleSsh) writeTrace(record traceRecord) {
+	data := e.data()
+	if data.TraceFilePath == "" {
+		return
+	}
+	line, err := json.Marshal(record)
+	if err == nil {
+		err = e.traceFile.write(data.TraceFilePath, int64(data.TraceMaxSizeKB)*1024, 1, string(line)+"\n")
+	}
+	if err != nil {
+		e.addAndUpdateConsole(red.Sprint("Failed to write trace file: "), err.Error())
+	}
+}
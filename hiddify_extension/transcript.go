@@ -0,0 +1,98 @@
+package hiddify_extension
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Size of the kept session transcript when none is configured
+const defaultTranscriptMaxKB = 256
+
+// transcript keeps the timestamped input and output of recent sessions, oldest first
+type transcript struct {
+	mu   sync.Mutex
+	text string
+}
+
+// recordLocked appends data from stream, one timestamped line per line of data, and drops the
+// oldest lines beyond maxSize bytes; the caller must hold mu
+func (t *transcript) recordLocked(maxSize int, stream string, data string) {
+	var sb strings.Builder
+	stamp := time.Now().Format(time.RFC3339) + " " + stream + "| "
+	for _, line := range strings.SplitAfter(data, "\n") {
+		if line == "" {
+			continue
+		}
+		sb.WriteString(stamp)
+		sb.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			sb.WriteByte('\n') // Partial lines continue in the next entry
+		}
+	}
+
+	text := t.text + sb.String()
+	if len(text) > maxSize {
+		text = text[len(text)-maxSize:]
+		if idx := strings.IndexByte(text, '\n'); idx >= 0 {
+			text = text[idx+1:] // Do not start in the middle of a line
+		}
+	}
+	t.text = text
+}
+
+// recordTranscript appends data to the transcript when recording is enabled
+func (e *HiddifyExtensionSimpleSsh) recordTranscript(stream string, data string) {
+	settings := e.data()
+	if !settings.RecordTranscript {
+		return
+	}
+	e.transcript.mu.Lock()
+	defer e.transcript.mu.Unlock()
+	e.transcript.recordLocked(settings.TranscriptMaxKB*1024, stream, data)
+}
+
+// startTranscript marks the start of a session in the transcript
+func (e *HiddifyExtensionSimpleSsh) startTranscript(description string) {
+	if !e.data().RecordTranscript {
+		return
+	}
+	e.addAndUpdateConsole(yellow.Sprint("Recording transcript: "), "session output is kept unredacted and may contain sensitive data")
+	e.recordTranscript("session", description+"\n")
+}
+
+// transcriptWriter passes session output to w, one write at a time, and records it
+type transcriptWriter struct {
+	e      *HiddifyExtensionSimpleSsh
+	w      io.Writer
+	stream string
+}
+
+// Write forwards p and records it; writers of one session are serialized by the transcript lock
+func (w transcriptWriter) Write(p []byte) (int, error) {
+	w.e.transcript.mu.Lock()
+	n, err := w.w.Write(p)
+	if data := w.e.data(); data.RecordTranscript {
+		w.e.transcript.recordLocked(data.TranscriptMaxKB*1024, w.stream, string(p[:n]))
+	}
+	w.e.transcript.mu.Unlock()
+	return n, err
+}
+
+// showTranscript displays the recorded transcript
+func (e *HiddifyExtensionSimpleSsh) showTranscript() {
+	e.transcript.mu.Lock()
+	text := e.transcript.text
+	e.transcript.mu.Unlock()
+
+	if text == "" {
+		message := "No session has been recorded yet."
+		if !e.data().RecordTranscript {
+			message += " Enable \"Record Session Transcript\" first."
+		}
+		e.ShowMessage("Session Transcript", message)
+		return
+	}
+	e.ShowMessage("Session Transcript", "Warning: the transcript is not redacted and may contain sensitive output.\n\n"+sanitizeText(text))
+}
@@ -0,0 +1,178 @@
+package hiddify_extension
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"nhooyr.io/websocket"
+)
+
+// Transport types used to reach the SSH server
+const (
+	TransportTCP       = "tcp"
+	TransportWebSocket = "websocket"
+	TransportTLS       = "tls"
+)
+
+// validateTransport checks the transport specific settings
+func validateTransport(data HiddifyExtensionSimpleSshData) error {
+	switch data.Transport {
+	case TransportTCP, TransportTLS, "":
+	case TransportWebSocket:
+		u, err := url.Parse(data.WebSocketURL)
+		if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			return invalidField(WebSocketURLKey, fmt.Errorf("WebSocket URL must be a ws:// or wss:// URL"))
+		}
+	default:
+		return invalidField(TransportKey, fmt.Errorf("unknown transport %q", data.Transport))
+	}
+	return nil
+}
+
+// dialSSH opens the configured transport and performs the SSH handshake over it
+func (e *HiddifyExtensionSimpleSsh) dialSSH(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := e.dialTransport(ctx, address, config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	conn = e.traceConn(conn, "ssh", address)
+	e.setProgress("Handshaking with " + address)
+	client, err := e.handshake(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// dialTransport opens the underlying connection used to carry the SSH stream
+func (e *HiddifyExtensionSimpleSsh) dialTransport(ctx context.Context, address string, timeout time.Duration) (net.Conn, error) {
+	data := e.data()
+	netDialer := &net.Dialer{Timeout: timeout, Resolver: e.connectResolver(ctx), Control: e.dscpControl()}
+
+	if data.Transport == TransportWebSocket {
+		e.addAndUpdateConsole(yellow.Sprint("Connecting via WebSocket: "), redactURL(data.WebSocketURL))
+		wsURL, _ := url.Parse(data.WebSocketURL) // Checked by validateTransport
+		proxy, err := e.environmentProxy(&url.URL{Scheme: strings.Replace(wsURL.Scheme, "ws", "http", 1), Host: wsURL.Host})
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dialWebSocket(ctx, netDialer, proxy, data.WebSocketURL, data.InsecureTLS)
+		if err != nil {
+			return nil, describeTLSError(err)
+		}
+		return tunneledConn{Conn: conn, target: address}, nil
+	}
+
+	// TCP based transports honor the proxy environment through HTTP CONNECT
+	proxy, err := e.environmentProxy(&url.URL{Scheme: "https", Host: address})
+	if err != nil {
+		return nil, err
+	}
+	dialer := proxyDialer{netDialer: netDialer, proxy: proxy}
+
+	// The host key is still checked against the host name, only the dial uses the pinned IP
+	target, err := e.pinnedDialAddress(ctx, netDialer.Resolver, address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Optionally confirm the port answers before starting the handshake
+	if data.PortCheck {
+		if err := e.checkPort(ctx, dialer, target); err != nil {
+			return nil, err
+		}
+	}
+
+	switch data.Transport {
+	case TransportTLS:
+		// The certificate belongs to the host being dialed, which is the first jump host if any
+		serverName, _, _ := net.SplitHostPort(address)
+		if serverName == data.IP && data.TLSServerName != "" {
+			serverName = data.TLSServerName
+		}
+		e.addAndUpdateConsole(yellow.Sprint("Connecting via TLS: "), fmt.Sprintf("%s (SNI %s)", address, serverName))
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: data.InsecureTLS, // Optionally skip certificate verification
+		})
+		handshakeCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if err := tlsConn.HandshakeContext(handshakeCtx); err != nil {
+			conn.Close()
+			return nil, describeTLSError(err)
+		}
+		return tlsConn, nil
+	default:
+		e.addAndUpdateConsole(yellow.Sprint("Connecting via TCP: "), target)
+		return dialer.DialContext(ctx, "tcp", target)
+	}
+}
+
+// redactURL removes the user name and password from a URL for display
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	u.User = nil
+	return u.String()
+}
+
+// dialWebSocket opens a WebSocket connection and exposes it as a byte stream
+func dialWebSocket(ctx context.Context, netDialer *net.Dialer, proxy *url.URL, wsURL string, insecure bool) (net.Conn, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxy), // Direct when nil
+			DialContext:     netDialer.DialContext,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure}, // Optionally skip certificate verification
+		},
+	}
+
+	// Credentials in the URL are sent as a header instead, so errors quoting the URL cannot reveal them
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+password)))
+		u.User = nil
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, netDialer.Timeout)
+	defer cancel()
+	c, _, err := websocket.Dial(dialCtx, u.String(), &websocket.DialOptions{HTTPClient: client, HTTPHeader: header})
+	if err != nil {
+		return nil, fmt.Errorf("WebSocket dial failed: %w", err)
+	}
+
+	// SSH packets may span large WebSocket messages
+	c.SetReadLimit(math.MaxInt64)
+	return websocket.NetConn(ctx, c, websocket.MessageBinary), nil
+}
+
+// describeTLSError turns certificate verification failures into a clear error
+func describeTLSError(err error) error {
+	var verifyErr *tls.CertificateVerificationError
+	if errors.As(err, &verifyErr) {
+		return fmt.Errorf("TLS certificate verification failed: %w (enable \"Skip TLS Certificate Verification\" to ignore)", verifyErr.Err)
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package hiddify_extension
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Trust policies for a server with neither pinned keys nor a known_hosts file
+const (
+	TrustPolicyStrict = "strict" // Refuse the connection
+	TrustPolicyTOFU   = "tofu"   // Accept the key and pin it (trust on first use)
+	TrustPolicyAsk    = "ask"    // Refuse the connection until the user trusts the key
+)
+
+// validTrustPolicy reports whether policy is a known trust policy
+func validTrustPolicy(policy string) bool {
+	switch policy {
+	case TrustPolicyStrict, TrustPolicyTOFU, TrustPolicyAsk:
+		return true
+	}
+	return false
+}
+
+// unknownHostCallback applies the trust policy to the key of a host nothing is known about yet,
+// the server or one of the jump hosts at hops
+func (e *HiddifyExtensionSimpleSsh) unknownHostCallback(hops []string) ssh.HostKeyCallback {
+	policy := e.data().TrustPolicy
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		fingerprint := ssh.FingerprintSHA256(key)
+		switch policy {
+		case TrustPolicyTOFU:
+			e.pinHostKey(key, hostname, hops)
+			e.addAndUpdateConsole(yellow.Sprint("Trust policy (tofu): "), fmt.Sprintf("first use of %s, pinned %s %s", hostname, key.Type(), fingerprint))
+			return nil
+		case TrustPolicyStrict:
+			e.addAndUpdateConsole(red.Sprint("Trust policy (strict): "), fmt.Sprintf("no pinned keys or known_hosts file to verify %s %s of %s", key.Type(), fingerprint, hostname))
+			return fmt.Errorf("host key %s of %s cannot be verified: no pinned keys or known_hosts file", fingerprint, hostname)
+		default:
+			e.addAndUpdateConsole(yellow.Sprint("Trust policy (ask): "), fmt.Sprintf("%s presented the unknown key %s %s, check it and choose \"Trust last host key\" to connect", hostname, key.Type(), fingerprint))
+			if e.formActive.Load() {
+				e.ShowMessage("Unknown Host Key", fmt.Sprintf("%s presented a host key that is not trusted yet:\n\n%s %s\n\n%s\n\nIf it matches the host's key, choose \"Trust last host key\" and connect again.", hostname, key.Type(), fingerprint, randomart(key)))
+			}
+			return fmt.Errorf("host key %s of %s is not trusted yet", fingerprint, hostname)
+		}
+	}
+}
+
+// pinHostKey adds key to the pinned host keys of host unless it is pinned for it already. Keys
+// of the jump hosts at hops get the host's address as comment, so they apply to that host alone.
+func (e *HiddifyExtensionSimpleSsh) pinHostKey(key ssh.PublicKey, host string, hops []string) bool {
+	e.dataMu.Lock()
+	defer e.dataMu.Unlock()
+	pins, err := parsePinnedHostKeys(e.Base.Data.HostKeys)
+	if err != nil {
+		return false
+	}
+	fingerprint := ssh.FingerprintSHA256(key)
+	for _, pin := range hostPins(pins, host, hops) {
+		if pin.fingerprint == fingerprint {
+			return false
+		}
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	if slices.Contains(hops, host) {
+		line += " " + host
+	}
+	pinned := strings.TrimRight(e.Base.Data.HostKeys, "\n")
+	if strings.TrimSpace(pinned) != "" {
+		pinned += "\n"
+	}
+	e.Base.Data.HostKeys = pinned + line
+	return true
+}
+
+// trustPresentedKey pins the host key presented on the last connection
+func (e *HiddifyExtensionSimpleSsh) trustPresentedKey() {
+	e.presentedKey.mu.Lock()
+	key, address := e.presentedKey.key, e.presentedKey.address
+	e.presentedKey.mu.Unlock()
+
+	if key == nil {
+		e.ShowMessage("Host Key", "No host key has been seen yet. Connect first, then trust the key.")
+		return
+	}
+	hops, _ := jumpHostAddresses(e.data().JumpHosts) // Checked by the form
+	if !e.pinHostKey(key, address, hops) {
+		e.addAndUpdateConsole(yellow.Sprint("Host key already trusted: "), address+" "+e.fingerprint(key))
+		return
+	}
+	e.addAndUpdateConsole(green.Sprint("Host key trusted: "), address+" "+e.fingerprint(key)+", added to the pinned host keys")
+}
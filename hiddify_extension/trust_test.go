@@ -0,0 +1,79 @@
+package hiddify_extension
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTrustPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+		pinned  bool // Whether the key is pinned afterwards
+		console string
+	}{
+		{TrustPolicyStrict, true, false, "no pinned keys or known_hosts file"},
+		{TrustPolicyTOFU, false, true, "first use of ssh.test"},
+		{TrustPolicyAsk, true, false, "choose \"Trust last host key\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			server := newTestServer(t, "secret")
+			e := newTestExtension(t, server)
+			e.Base.Data.HostKeys = ""
+			e.Base.Data.TrustPolicy = tt.policy
+
+			client, err := e.connect(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("connect() error = %v, want error %v", err, tt.wantErr)
+			}
+			if client != nil {
+				client.Close()
+			}
+			if pinned := e.data().HostKeys == server.pin(); pinned != tt.pinned {
+				t.Errorf("host keys = %q, want the server's key pinned %v", e.data().HostKeys, tt.pinned)
+			}
+			if !strings.Contains(e.consoleText(), tt.console) {
+				t.Errorf("console lacks %q:\n%s", tt.console, e.consoleText())
+			}
+		})
+	}
+}
+
+func TestTrustPolicyTOFUKeepsPin(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+	e.Base.Data.HostKeys = ""
+	e.Base.Data.TrustPolicy = TrustPolicyTOFU
+
+	client, err := e.connect(context.Background())
+	if err != nil {
+		t.Fatalf("connect() error = %v", err)
+	}
+	client.Close()
+
+	// Once pinned, a different key is a mismatch rather than another first use
+	impostor := newTestServer(t, "secret")
+	e.SetDialer(impostor.dialer())
+	if _, err := e.connect(context.Background()); err == nil {
+		t.Fatal("connect() accepted a different key after trusting the first one")
+	}
+}
+
+func TestTrustPresentedKeyAfterAsk(t *testing.T) {
+	server := newTestServer(t, "secret")
+	e := newTestExtension(t, server)
+	e.Base.Data.HostKeys = ""
+	e.Base.Data.TrustPolicy = TrustPolicyAsk
+
+	if _, err := e.connect(context.Background()); err == nil {
+		t.Fatal("connect() accepted an unknown key")
+	}
+	e.trustPresentedKey()
+	client, err := e.connect(context.Background())
+	if err != nil {
+		t.Fatalf("connect() after trusting the key error = %v", err)
+	}
+	client.Close()
+}
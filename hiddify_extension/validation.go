@@ -0,0 +1,32 @@
+package hiddify_extension
+
+// ValidationError reports an invalid form value together with the key of the field it came from
+type ValidationError struct {
+	Field string // Key of the offending form field
+	Err   error  // What is wrong with the value
+}
+
+// Error returns the validation message
+func (v *ValidationError) Error() string {
+	return v.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (v *ValidationError) Unwrap() error {
+	return v.Err
+}
+
+// invalidField wraps err as a validation error for the given form field
+func invalidField(field string, err error) error {
+	return &ValidationError{Field: field, Err: err}
+}
+
+// fieldLabel returns the label of a form field, or its key when the field is not a setting
+func (e *HiddifyExtensionSimpleSsh) fieldLabel(key string) string {
+	for _, field := range append(e.settingsFields(), e.shellFields()...) {
+		if field.Key == key {
+			return field.Label
+		}
+	}
+	return key
+}
@@ -0,0 +1,97 @@
+package hiddify_extension
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetFormDataInvalidField(t *testing.T) {
+	tests := []struct {
+		field string
+		data  map[string]string
+	}{
+		{PortKey, map[string]string{PortKey: "port"}},
+		{FallbackPortsKey, map[string]string{FallbackPortsKey: "2222,x"}},
+		{KeyTypeKey, map[string]string{KeyTypeKey: "dsa"}},
+		{ForwardAgentKey, map[string]string{UseAgentKey: "false", ForwardAgentKey: "true"}},
+		{MaxKeysKey, map[string]string{MaxKeysKey: "-1"}},
+		{ModeKey, map[string]string{ModeKey: "tunnel"}},
+		{SubsystemKey, map[string]string{SubsystemKey: ""}},
+		{LatencySamplesKey, map[string]string{LatencySamplesKey: "0"}},
+		{SpeedTestMBKey, map[string]string{SpeedTestMBKey: "0"}},
+		{AlgorithmPresetKey, map[string]string{AlgorithmPresetKey: "fastest"}},
+		{CiphersKey, map[string]string{CiphersKey: "rot13"}},
+		{KeyExchangesKey, map[string]string{KeyExchangesKey: "rot13"}},
+		{MACsKey, map[string]string{MACsKey: "rot13"}},
+		{HostKeyAlgorithmsKey, map[string]string{HostKeyAlgorithmsKey: "rot13"}},
+		{HostKeysKey, map[string]string{HostKeysKey: "not a key"}},
+		{TrustPolicyKey, map[string]string{TrustPolicyKey: "always"}},
+		{RekeyThresholdKey, map[string]string{RekeyThresholdKey: "5"}},
+		{KnownHostsMatchKey, map[string]string{KnownHostsMatchKey: "name"}},
+		{FingerprintFormatKey, map[string]string{FingerprintFormatKey: "crc"}},
+		{TransportKey, map[string]string{TransportKey: "quic"}},
+		{WebSocketURLKey, map[string]string{TransportKey: TransportWebSocket, WebSocketURLKey: "http://ws.test"}},
+		{LocalDNSKey, map[string]string{LocalDNSKey: "dns.test"}},
+		{DSCPKey, map[string]string{DSCPKey: "64"}},
+		{SplitTunnelRulesKey, map[string]string{SplitTunnelRulesKey: "example.com"}},
+		{UpstreamOutboundKey, map[string]string{SplitTunnelRulesKey: "domain:example.com", UpstreamOutboundKey: outboundTag}},
+		{UpstreamOutboundKey, map[string]string{SplitTunnelRulesKey: "", UpstreamOutboundKey: "vpn"}},
+		{JumpHostsKey, map[string]string{JumpHostsKey: "user:secret@jump.test"}},
+		{ConsoleWidthKey, map[string]string{ConsoleWidthKey: "5"}},
+		{ServerAliveIntervalKey, map[string]string{ServerAliveIntervalKey: "-1"}},
+		{ServerAliveCountMaxKey, map[string]string{ServerAliveCountMaxKey: "0"}},
+		{ConnectAttemptsKey, map[string]string{ConnectAttemptsKey: "0"}},
+		{ConnectRateKey, map[string]string{ConnectRateKey: "-1"}},
+		{ConnectTimeoutKey, map[string]string{ConnectTimeoutKey: "0"}},
+		{ConnectTimeoutMaxKey, map[string]string{ConnectTimeoutKey: "10", ConnectTimeoutMaxKey: "5"}},
+		{HandshakeTimeoutKey, map[string]string{HandshakeTimeoutKey: "-1"}},
+		{HealthPortKey, map[string]string{HealthPortKey: "70000"}},
+		{GlobalRequestKey, map[string]string{GlobalRequestKey: "keep alive"}},
+		{MTUProbeMinKey, map[string]string{MTUProbeMinKey: "small"}},
+		{MTUProbeMaxKey, map[string]string{MTUProbeMaxKey: "large"}},
+		{MTUProbeTargetKey, map[string]string{MTUProbeKey: "true", MTUProbeTargetKey: "no-port"}},
+		{ShellColumnsKey, map[string]string{ShellColumnsKey: "0"}},
+		{ShellRowsKey, map[string]string{ShellRowsKey: "0"}},
+		{LogMaxSizeKBKey, map[string]string{LogMaxSizeKBKey: "0"}},
+		{LogMaxFilesKey, map[string]string{LogMaxFilesKey: "-1"}},
+		{TraceMaxSizeKBKey, map[string]string{TraceMaxSizeKBKey: "0"}},
+		{TranscriptMaxKBKey, map[string]string{TranscriptMaxKBKey: "0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			e := NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh)
+			before := e.data()
+
+			// Valid fields submitted along with the invalid one must not be applied either
+			submitted := map[string]string{IPKey: "changed.test", UsernameKey: "changed"}
+			for key, value := range tt.data {
+				submitted[key] = value
+			}
+			err := e.setFormData(submitted)
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("setFormData() error = %v, want a ValidationError", err)
+			}
+			if invalid.Field != tt.field {
+				t.Errorf("ValidationError.Field = %q, want %q", invalid.Field, tt.field)
+			}
+			if e.data() != before {
+				t.Error("a rejected submit changed the settings")
+			}
+		})
+	}
+}
+
+func TestSetFormDataApplies(t *testing.T) {
+	e := NewHiddifyExtensionSimpleSsh().(*HiddifyExtensionSimpleSsh)
+	e.workingPort.Store("2222")
+	if err := e.setFormData(map[string]string{IPKey: "ssh.test", PortKey: "2200", ConnectAttemptsKey: "5"}); err != nil {
+		t.Fatalf("setFormData() error = %v", err)
+	}
+	if data := e.data(); data.IP != "ssh.test" || data.Port != "2200" || data.ConnectAttempts != 5 {
+		t.Errorf("settings = %q, %q, %d, want the submitted values", data.IP, data.Port, data.ConnectAttempts)
+	}
+	if port := e.workingPort.Load(); port != "" {
+		t.Errorf("working port = %q, want it reset when the port changes", port)
+	}
+}